@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Name of the securityDefinition added for spec.apiKeys.
+	apiKeySecurityDefinition = "api_key"
+	// Unit of the quota limits, requests per minute per consumer project.
+	quotaLimitUnit = "1/min/{project}"
+)
+
+// Valid quota metric names.
+var quotaMetricNameRegexp = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// applyAPIManagement merges spec.apiKeys and spec.quota into the rendered OpenAPI spec.
+// The spec is returned unchanged when neither is set or the merge changes nothing, otherwise it is re-encoded as JSON or YAML
+// with the order of its keys and its integers kept. Comments are not kept in a re-encoded spec.
+func applyAPIManagement(parent *CloudEndpoint, specData string, asJSON bool) (string, error) {
+	apiKeys, quota := parent.Spec.APIKeys, parent.Spec.Quota
+	if apiKeys == nil && quota == nil {
+		return specData, nil
+	}
+	if err := validateQuotaSpec(quota); err != nil {
+		return "", err
+	}
+
+	spec, err := decodeSpecMap(specData)
+	if err != nil {
+		return "", err
+	}
+	paths, _ := spec.get("paths").(*specMap)
+	topSecurity, _ := spec.get("security").([]interface{})
+
+	if apiKeys != nil {
+		name, in := apiKeys.Name, apiKeys.In
+		if name == "" {
+			name = "key"
+		}
+		if in == "" {
+			in = "query"
+		}
+		if in != "query" && in != "header" {
+			return "", fmt.Errorf("Invalid apiKeys.in: '%s', must be one of: query, header", apiKeys.In)
+		}
+		definition := newSpecMap()
+		definition.set("type", "apiKey")
+		definition.set("name", name)
+		definition.set("in", in)
+		nestedMap(spec, "securityDefinitions").set(apiKeySecurityDefinition, definition)
+		forEachOperation(paths, func(p, method string, op *specMap) {
+			if len(apiKeys.Paths) > 0 && matchPaths(apiKeys.Paths, p) == false {
+				return
+			}
+			requirements, ok := op.get("security").([]interface{})
+			if ok == false {
+				requirements = topSecurity
+			}
+			op.set("security", addAPIKeyRequirement(requirements))
+		})
+	}
+
+	if quota != nil {
+		management := nestedMap(spec, "x-google-management")
+		metrics, _ := management.get("metrics").([]interface{})
+		quotaSection := nestedMap(management, "quota")
+		limits, _ := quotaSection.get("limits").([]interface{})
+		for _, m := range quota.Metrics {
+			displayName := m.DisplayName
+			if displayName == "" {
+				displayName = m.Name
+			}
+			metric := newSpecMap()
+			metric.set("name", m.Name)
+			metric.set("displayName", displayName)
+			metric.set("valueType", "INT64")
+			metric.set("metricKind", "DELTA")
+			metrics = replaceNamed(metrics, m.Name, metric)
+
+			values := newSpecMap()
+			values.set("STANDARD", m.LimitPerMinute)
+			limit := newSpecMap()
+			limit.set("name", m.Name+"-limit")
+			limit.set("metric", m.Name)
+			limit.set("unit", quotaLimitUnit)
+			limit.set("values", values)
+			limits = replaceNamed(limits, m.Name+"-limit", limit)
+		}
+		management.set("metrics", metrics)
+		quotaSection.set("limits", limits)
+
+		definitions, _ := spec.get("securityDefinitions").(*specMap)
+		diagnostics := make([]string, 0)
+		for i, c := range quota.Costs {
+			forEachOperation(paths, func(p, method string, op *specMap) {
+				if len(c.Paths) > 0 && matchPaths(c.Paths, p) == false {
+					return
+				}
+				if len(c.Methods) > 0 && containsFold(c.Methods, method) == false {
+					return
+				}
+				requirements, ok := op.get("security").([]interface{})
+				if ok == false {
+					requirements = topSecurity
+				}
+				if requiresAPIKey(requirements, definitions) == false {
+					diagnostics = append(diagnostics, fmt.Sprintf("quota.costs[%d] applies to paths.%s.%s which does not require an API key", i, p, method))
+					return
+				}
+				nestedMap(nestedMap(op, "x-google-quota"), "metricCosts").set(c.Metric, c.Cost)
+			})
+		}
+		if len(diagnostics) > 0 {
+			return "", &validationError{diagnostics}
+		}
+	}
+
+	out, err := encodeSpecMap(spec, asJSON)
+	if err != nil {
+		return "", err
+	}
+	// Re-encoding the unmerged spec shows whether the merge changed anything, the original text is kept if it did not.
+	original, _ := decodeSpecMap(specData)
+	if unmerged, err := encodeSpecMap(original, asJSON); err == nil && unmerged == out {
+		return specData, nil
+	}
+	return out, nil
+}
+
+// specMap is a mapping of the OpenAPI spec that keeps the order of its keys when it is encoded again.
+// Integers are kept as the int, int64 or uint64 values decoded by yaml.v2, not converted to float64 like a JSON round trip does.
+type specMap struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func newSpecMap() *specMap {
+	return &specMap{values: make(map[string]interface{})}
+}
+
+func (m *specMap) get(key string) interface{} {
+	return m.values[key]
+}
+
+// set replaces the value of the key, a new key is added last.
+func (m *specMap) set(key string, value interface{}) {
+	if _, ok := m.values[key]; ok == false {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
+}
+
+// MarshalJSON encodes the mapping as a JSON object with the keys in order.
+func (m *specMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// MarshalYAML encodes the mapping as a yaml.MapSlice with the keys in order.
+func (m *specMap) MarshalYAML() (interface{}, error) {
+	items := make(yaml.MapSlice, 0, len(m.keys))
+	for _, k := range m.keys {
+		items = append(items, yaml.MapItem{Key: k, Value: m.values[k]})
+	}
+	return items, nil
+}
+
+// decodeSpecMap decodes the YAML or JSON spec, JSON is decoded as YAML.
+func decodeSpecMap(specData string) (*specMap, error) {
+	var items yaml.MapSlice
+	if err := yaml.Unmarshal([]byte(specData), &items); err != nil {
+		return nil, err
+	}
+	return toSpecValue(items).(*specMap), nil
+}
+
+// toSpecValue converts the yaml.MapSlice mappings decoded by yaml.v2 to specMaps with string keys.
+func toSpecValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case yaml.MapSlice:
+		m := newSpecMap()
+		for _, item := range v {
+			m.set(fmt.Sprint(item.Key), toSpecValue(item.Value))
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = toSpecValue(item)
+		}
+		return list
+	default:
+		return v
+	}
+}
+
+func encodeSpecMap(spec *specMap, asJSON bool) (string, error) {
+	var out []byte
+	var err error
+	if asJSON {
+		out, err = json.MarshalIndent(spec, "", "  ")
+	} else {
+		out, err = yaml.Marshal(spec)
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// validateQuotaSpec checks that the quota metrics are valid and unique and that the costs reference them.
+func validateQuotaSpec(quota *CloudEndpointQuota) error {
+	if quota == nil {
+		return nil
+	}
+	names := make(map[string]bool)
+	for i, m := range quota.Metrics {
+		if quotaMetricNameRegexp.MatchString(m.Name) == false {
+			return fmt.Errorf("quota.metrics[%d].name must start with a lowercase letter and contain only lowercase letters, digits and '-', found: '%s'", i, m.Name)
+		}
+		if names[m.Name] {
+			return fmt.Errorf("quota.metrics[%d].name '%s' is not unique", i, m.Name)
+		}
+		if m.LimitPerMinute <= 0 {
+			return fmt.Errorf("quota.metrics[%d].limitPerMinute must be greater than 0", i)
+		}
+		names[m.Name] = true
+	}
+	for i, c := range quota.Costs {
+		if names[c.Metric] == false {
+			return fmt.Errorf("quota.costs[%d].metric references undefined metric: '%s'", i, c.Metric)
+		}
+		if c.Cost <= 0 {
+			return fmt.Errorf("quota.costs[%d].cost must be greater than 0", i)
+		}
+	}
+	return nil
+}
+
+// forEachOperation calls fn for every operation of the OpenAPI paths, in the order of the spec.
+func forEachOperation(paths *specMap, fn func(p, method string, op *specMap)) {
+	if paths == nil {
+		return
+	}
+	for _, p := range paths.keys {
+		pathItem, ok := paths.get(p).(*specMap)
+		if ok == false {
+			continue
+		}
+		for _, method := range openAPIOperations {
+			if op, ok := pathItem.get(method).(*specMap); ok {
+				fn(p, method, op)
+			}
+		}
+	}
+}
+
+// matchPaths returns true if the OpenAPI path equals one of the patterns or matches it as a glob.
+func matchPaths(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if pattern == p {
+			return true
+		}
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// addAPIKeyRequirement returns the security requirements with the API key added to each of them, or only the API key without requirements.
+func addAPIKeyRequirement(requirements []interface{}) []interface{} {
+	if len(requirements) == 0 {
+		requirement := newSpecMap()
+		requirement.set(apiKeySecurityDefinition, []interface{}{})
+		return []interface{}{requirement}
+	}
+	result := make([]interface{}, 0, len(requirements))
+	for _, r := range requirements {
+		requirement := newSpecMap()
+		if m, ok := r.(*specMap); ok {
+			for _, k := range m.keys {
+				requirement.set(k, m.get(k))
+			}
+		}
+		if _, ok := requirement.values[apiKeySecurityDefinition]; ok == false {
+			requirement.set(apiKeySecurityDefinition, []interface{}{})
+		}
+		result = append(result, requirement)
+	}
+	return result
+}
+
+// requiresAPIKey returns true if every security requirement includes an apiKey securityDefinition.
+func requiresAPIKey(requirements []interface{}, definitions *specMap) bool {
+	if len(requirements) == 0 || definitions == nil {
+		return false
+	}
+	for _, r := range requirements {
+		requirement, ok := r.(*specMap)
+		if ok == false {
+			return false
+		}
+		found := false
+		for _, name := range requirement.keys {
+			if def, ok := definitions.get(name).(*specMap); ok && def.get("type") == "apiKey" {
+				found = true
+			}
+		}
+		if found == false {
+			return false
+		}
+	}
+	return true
+}
+
+// nestedMap returns the mapping stored at key, creating it if it is missing.
+func nestedMap(m *specMap, key string) *specMap {
+	if v, ok := m.get(key).(*specMap); ok {
+		return v
+	}
+	v := newSpecMap()
+	m.set(key, v)
+	return v
+}
+
+// replaceNamed replaces the list item with the given name, or appends the item if there is none.
+func replaceNamed(list []interface{}, name string, item *specMap) []interface{} {
+	for i, existing := range list {
+		if m, ok := existing.(*specMap); ok && m.get("name") == name {
+			list[i] = item
+			return list
+		}
+	}
+	return append(list, item)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
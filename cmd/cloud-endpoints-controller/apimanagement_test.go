@@ -0,0 +1,113 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSyncAPIManagement(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name:  "API keys are required on the wildcard spec",
+			spec:  func(parent *CloudEndpoint) { parent.Spec.APIKeys = &CloudEndpointAPIKeys{} },
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if spec := submittedFiles(t, env, 0)[0]; strings.Contains(spec, apiKeySecurityDefinition) == false {
+					t.Errorf("API key security definition missing from spec:\n%s", spec)
+				}
+			},
+		},
+		{
+			name: "invalid quota metric backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Quota = &CloudEndpointQuota{Metrics: []CloudEndpointQuotaMetric{{Name: "Read_Requests", LimitPerMinute: 100}}}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "InvalidSpec"},
+		},
+		{
+			name: "API keys with gRPC backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.GRPC = &CloudEndpointGRPCSpec{DescriptorSet: "Cg==", ServiceConfig: "type: google.api.Service"}
+				parent.Spec.APIKeys = &CloudEndpointAPIKeys{}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "InvalidSpec"},
+		},
+	})
+}
+
+const testAPIManagementSpec = `# Users API
+swagger: "2.0"
+info:
+  title: users
+  version: 1.0.0
+host: users.example.com
+paths:
+  /v1/users:
+    get:
+      operationId: ListUsers
+      parameters:
+      - name: limit
+        in: query
+        type: integer
+        maximum: 9223372036854775807
+      responses:
+        200:
+          description: OK
+`
+
+func TestApplyAPIManagement(t *testing.T) {
+	parent := newTestParent()
+	parent.Spec.APIKeys = &CloudEndpointAPIKeys{}
+	parent.Spec.Quota = &CloudEndpointQuota{
+		Metrics: []CloudEndpointQuotaMetric{{Name: "read-requests", LimitPerMinute: 1000}},
+		Costs:   []CloudEndpointQuotaCost{{Metric: "read-requests", Cost: 1}},
+	}
+
+	merged, err := applyAPIManagement(parent, testAPIManagementSpec, false)
+	if err != nil {
+		t.Fatalf("applyAPIManagement() = %v", err)
+	}
+	for _, want := range []string{"maximum: 9223372036854775807", "security:\n      - api_key: []", "read-requests: 1", "STANDARD: 1000"} {
+		if strings.Contains(merged, want) == false {
+			t.Errorf("merged spec does not contain %q:\n%s", want, merged)
+		}
+	}
+	order := []string{"swagger:", "info:", "host:", "paths:", "securityDefinitions:", "x-google-management:"}
+	for i := 1; i < len(order); i++ {
+		if strings.Index(merged, order[i-1]) > strings.Index(merged, order[i]) {
+			t.Errorf("%s is not before %s in the merged spec:\n%s", order[i-1], order[i], merged)
+		}
+	}
+
+	if again, err := applyAPIManagement(parent, merged, false); err != nil || again != merged {
+		t.Errorf("merging the merged spec again = %v, changed:\n%s", err, again)
+	}
+	commented := "# Merged by hand\n" + merged
+	if again, err := applyAPIManagement(parent, commented, false); err != nil || again != commented {
+		t.Errorf("merging an unchanged spec with comments = %v, want it returned as written:\n%s", err, again)
+	}
+}
+
+func TestApplyAPIManagementJSON(t *testing.T) {
+	parent := newTestParent()
+	parent.Spec.APIKeys = &CloudEndpointAPIKeys{Name: "x-api-key", In: "header"}
+	specJSON := `{"swagger": "2.0", "host": "users.example.com", "paths": {"/v1/users": {"get": {"operationId": "ListUsers", "x-max": 18446744073709551615}}}}`
+
+	merged, err := applyAPIManagement(parent, specJSON, true)
+	if err != nil {
+		t.Fatalf("applyAPIManagement() = %v", err)
+	}
+	if strings.HasPrefix(merged, "{\n  \"swagger\": \"2.0\",\n  \"host\": \"users.example.com\",\n  \"paths\"") == false || strings.Contains(merged, "18446744073709551615") == false {
+		t.Errorf("merged JSON spec does not keep the key order and integers:\n%s", merged)
+	}
+	if strings.Contains(merged, `"name": "x-api-key"`) == false || strings.Contains(merged, `"in": "header"`) == false {
+		t.Errorf("merged JSON spec does not contain the header API key:\n%s", merged)
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Provider used when spec.authentication is not set and targetIngress.jwtServices are, to verify the IAP signed headers.
+	iapProviderName    = "google_jwt"
+	iapProviderIssuer  = "https://cloud.google.com/iap"
+	iapProviderJWKSURI = "https://www.gstatic.com/iap/verify/public_key-jwk"
+)
+
+// Valid securityDefinitions names.
+var authProviderNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// authProvider is a JWT authentication provider rendered into the OpenAPI securityDefinitions.
+type authProvider struct {
+	Name      string
+	Issuer    string
+	JWKSURI   string
+	Audiences []string
+}
+
+// authProviders returns the providers of spec.authentication with the JWT service audiences added to the providers that request them.
+// Without spec.authentication, the IAP provider is returned when there are JWT service audiences.
+func authProviders(parent *CloudEndpoint, jwtAudiences []string) ([]authProvider, error) {
+	providers := make([]authProvider, 0)
+	if parent.Spec.Authentication == nil || len(parent.Spec.Authentication.Providers) == 0 {
+		if len(jwtAudiences) > 0 {
+			providers = append(providers, authProvider{
+				Name:      iapProviderName,
+				Issuer:    iapProviderIssuer,
+				JWKSURI:   iapProviderJWKSURI,
+				Audiences: jwtAudiences,
+			})
+		}
+		return providers, nil
+	}
+
+	names := make(map[string]bool)
+	for i, p := range parent.Spec.Authentication.Providers {
+		if authProviderNameRegexp.MatchString(p.Name) == false {
+			return nil, fmt.Errorf("authentication.providers[%d].name must be set and contain only letters, digits, '_' and '-', found: '%s'", i, p.Name)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("authentication.providers[%d].name '%s' is not unique", i, p.Name)
+		}
+		names[p.Name] = true
+		if p.Issuer == "" {
+			return nil, fmt.Errorf("authentication.providers[%d].issuer must be set", i)
+		}
+		audiences := append([]string{}, p.Audiences...)
+		if p.AudiencesFromJWTServices {
+			if len(parent.Spec.TargetIngress.JWTServices) == 0 {
+				return nil, fmt.Errorf("authentication.providers[%d].audiencesFromJWTServices requires targetIngress.jwtServices", i)
+			}
+			audiences = append(audiences, jwtAudiences...)
+		}
+		providers = append(providers, authProvider{
+			Name:      p.Name,
+			Issuer:    p.Issuer,
+			JWKSURI:   p.JWKSURI,
+			Audiences: audiences,
+		})
+	}
+	return providers, nil
+}
+
+// renderAuthentication returns the top level security and securityDefinitions of the providers as YAML, or an empty string without providers.
+// A request is accepted if it carries a valid JWT from any of the providers.
+func renderAuthentication(providers []authProvider) template.HTML {
+	if len(providers) == 0 {
+		return ""
+	}
+	var b bytes.Buffer
+	b.WriteString("security:\n")
+	for _, p := range providers {
+		fmt.Fprintf(&b, "- %s: []\n", p.Name)
+	}
+	b.WriteString("securityDefinitions:\n")
+	for _, p := range providers {
+		fmt.Fprintf(&b, "  %s:\n", p.Name)
+		b.WriteString("    authorizationUrl: \"\"\n")
+		b.WriteString("    flow: \"implicit\"\n")
+		b.WriteString("    type: \"oauth2\"\n")
+		fmt.Fprintf(&b, "    x-google-issuer: %s\n", strconv.Quote(p.Issuer))
+		if p.JWKSURI != "" {
+			fmt.Fprintf(&b, "    x-google-jwks_uri: %s\n", strconv.Quote(p.JWKSURI))
+		}
+		if len(p.Audiences) > 0 {
+			fmt.Fprintf(&b, "    x-google-audiences: %s\n", strconv.Quote(strings.Join(p.Audiences, ",")))
+		}
+	}
+	// The output is YAML, not HTML, it must not be escaped by the template.
+	return template.HTML(b.String())
+}
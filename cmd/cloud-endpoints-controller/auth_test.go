@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestSyncAuthentication(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "authentication providers are added to the wildcard spec",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Authentication = &CloudEndpointAuthentication{Providers: []CloudEndpointAuthProvider{{
+					Name:      "firebase",
+					Issuer:    "https://securetoken.google.com/test-project",
+					JWKSURI:   "https://www.googleapis.com/service_accounts/v1/metadata/x509/securetoken@system.gserviceaccount.com",
+					Audiences: []string{testProject},
+				}}}
+			},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if spec := submittedFiles(t, env, 0)[0]; strings.Contains(spec, "securityDefinitions") == false || strings.Contains(spec, "securetoken.google.com") == false {
+					t.Errorf("authentication provider missing from spec:\n%s", spec)
+				}
+			},
+		},
+		{
+			name: "invalid authentication provider backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Authentication = &CloudEndpointAuthentication{Providers: []CloudEndpointAuthProvider{{Name: "fire base", Issuer: "https://securetoken.google.com/test-project"}}}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "InvalidSpec"},
+		},
+	})
+}
+
+func TestAuthProviders(t *testing.T) {
+	parent := newTestParent()
+	jwtAudiences := []string{"/projects/1/global/backendServices/2"}
+	if providers, err := authProviders(parent, jwtAudiences); err != nil || len(providers) != 1 || providers[0].Name != iapProviderName {
+		t.Errorf("authProviders() without spec.authentication = %+v, %v, want the IAP provider", providers, err)
+	}
+
+	parent.Spec.TargetIngress.JWTServices = []string{"web"}
+	parent.Spec.Authentication = &CloudEndpointAuthentication{Providers: []CloudEndpointAuthProvider{
+		{Name: "auth0", Issuer: "https://example.auth0.com/", Audiences: []string{"api"}, AudiencesFromJWTServices: true},
+	}}
+	providers, err := authProviders(parent, jwtAudiences)
+	if err != nil || len(providers) != 1 || fmt.Sprint(providers[0].Audiences) != "[api /projects/1/global/backendServices/2]" {
+		t.Errorf("authProviders() = %+v, %v", providers, err)
+	}
+	if rendered := string(renderAuthentication(providers)); strings.Contains(rendered, `x-google-audiences: "api,/projects/1/global/backendServices/2"`) == false {
+		t.Errorf("renderAuthentication() =\n%s", rendered)
+	}
+
+	for _, p := range [][]CloudEndpointAuthProvider{
+		{{Name: "auth0"}},
+		{{Name: "auth0", Issuer: "https://example.auth0.com/"}, {Name: "auth0", Issuer: "https://other.auth0.com/"}},
+	} {
+		parent.Spec.Authentication.Providers = p
+		if _, err := authProviders(parent, jwtAudiences); err == nil {
+			t.Errorf("authProviders(%+v) = nil, want an error", p)
+		}
+	}
+}
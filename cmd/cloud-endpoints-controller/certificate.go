@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	computebeta "google.golang.org/api/compute/v0.beta"
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Annotation of the GCE ingress controller listing the SSL certificates attached to the load balancer.
+	preSharedCertAnnotation = "ingress.gcp.kubernetes.io/pre-shared-cert"
+
+	// Interval between managed certificate status checks while the certificate is provisioning and once it is active.
+	certificateCheckProvisioning = 30 * time.Second
+	certificateCheckActive       = 10 * time.Minute
+
+	// Maximum length of a Compute resource name.
+	computeNameMaxLength = 63
+)
+
+// managedCertificateName returns the name of the managed certificate, which defaults to cloudep-NAMESPACE-NAME.
+func managedCertificateName(parent *CloudEndpoint) string {
+	if name := parent.Spec.ManagedCertificate.Name; name != "" {
+		return name
+	}
+	return computeResourceName(parent)
+}
+
+// computeResourceName returns the default name of the Compute resources created for the CloudEndpoint, cloudep-NAMESPACE-NAME truncated to a valid resource name.
+func computeResourceName(parent *CloudEndpoint) string {
+	name := strings.ToLower(fmt.Sprintf("cloudep-%s-%s", parent.Namespace, parent.Name))
+	name = strings.Replace(name, ".", "-", -1)
+	if len(name) > computeNameMaxLength {
+		// Keep the name unique when it is truncated.
+		name = fmt.Sprintf("%s-%x", strings.TrimRight(name[:computeNameMaxLength-9], "-"), sha1.Sum([]byte(name)))[:computeNameMaxLength]
+	}
+	return name
+}
+
+// syncManagedCertificate creates the managed certificate for the endpoint hostname, records its provisioning status and annotates the target Ingress.
+// An existing certificate with the same name is only used if it is a managed certificate for the endpoint hostname. Errors are reported with the CertificateReady condition and don't fail the sync.
+func syncManagedCertificate(ctx context.Context, parent *CloudEndpoint, status *CloudEndpointControllerStatus) {
+	logger := loggerFrom(ctx)
+	// The certificate conditions are not the cause of a sync error.
+	defer func(reason string) { status.lastReason = reason }(status.lastReason)
+
+	name := ""
+	if parent.Spec.ManagedCertificate != nil {
+		name = managedCertificateName(parent)
+	}
+
+	// Release a certificate that is no longer requested or was renamed.
+	if status.Certificate != nil && status.Certificate.Name != name {
+		if err := releaseManagedCertificate(ctx, parent, status); err != nil {
+			logger.WithError(err).Warn("Failed to release managed certificate")
+			return
+		}
+	}
+	if name == "" {
+		status.removeCondition(ConditionCertificateReady)
+		return
+	}
+
+	domain := fmt.Sprintf("%s.endpoints.%s.cloud.goog", parent.Name, parent.Spec.Project)
+	if status.Certificate == nil {
+		status.Certificate = &CloudEndpointCertificateStatus{Name: name}
+	}
+	cert := status.Certificate
+	cert.Domain = domain
+
+	// The certificate must exist before it is referenced by the Ingress.
+	if cert.Status != "" {
+		if err := syncCertificateIngress(ctx, parent, cert); err != nil {
+			logger.WithError(err).Warn("Failed to annotate Ingress with managed certificate")
+			status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "IngressAnnotationFailed", err.Error())
+			return
+		}
+	}
+
+	interval := certificateCheckProvisioning
+	if cert.Status == "ACTIVE" {
+		interval = certificateCheckActive
+	}
+	if cert.CheckTime != nil && time.Since(cert.CheckTime.Time) < interval {
+		return
+	}
+	checkTime := metav1.Now()
+	cert.CheckTime = &checkTime
+
+	sslCert, err := config.clientCompute.GetSslCertificate(ctx, parent.Spec.Project, name)
+	if err != nil {
+		if computeNotFound(err) == false {
+			status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "GetFailed", err.Error())
+			return
+		}
+		logger.WithField("certificate", name).Info("Creating managed certificate")
+		_, err := config.clientCompute.InsertSslCertificate(ctx, parent.Spec.Project, &computebeta.SslCertificate{
+			Name:        name,
+			Description: fmt.Sprintf("Managed certificate for CloudEndpoint %s/%s", parent.Namespace, parent.Name),
+			Type:        "MANAGED",
+			Managed: &computebeta.SslCertificateManagedSslCertificate{
+				Domains: []string{domain},
+			},
+		})
+		if err != nil {
+			status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "CreateFailed", err.Error())
+			recordEvent(parent, corev1.EventTypeWarning, "CertificateCreateFailed", "Failed to create managed certificate %s: %v", name, err)
+			return
+		}
+		cert.Status = "PROVISIONING"
+		cert.Created = true
+		status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "Provisioning", fmt.Sprintf("Waiting for managed certificate %s for %s", name, domain))
+		recordEvent(parent, corev1.EventTypeNormal, "CertificateCreated", "Created managed certificate %s for %s", name, domain)
+		return
+	}
+
+	if sslCert.Managed == nil {
+		cert.Status = ""
+		status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "NotManaged", fmt.Sprintf("SSL certificate %s exists and is not a managed certificate", name))
+		return
+	}
+	if containsFold(sslCert.Managed.Domains, domain) == false {
+		cert.Status = ""
+		status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "DomainMismatch", fmt.Sprintf("Managed certificate %s exists for %s and not for %s", name, strings.Join(sslCert.Managed.Domains, ", "), domain))
+		return
+	}
+	prevStatus := cert.Status
+	cert.Status = sslCert.Managed.Status
+	cert.DomainStatus = sslCert.Managed.DomainStatus
+
+	switch cert.Status {
+	case "ACTIVE":
+		status.setCondition(ConditionCertificateReady, corev1.ConditionTrue, "Active", fmt.Sprintf("Managed certificate %s is active for %s", name, domain))
+		if prevStatus != cert.Status {
+			recordEvent(parent, corev1.EventTypeNormal, "CertificateActive", "Managed certificate %s is active for %s", name, domain)
+		}
+	case "PROVISIONING":
+		status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "Provisioning", fmt.Sprintf("Waiting for managed certificate %s for %s, domain status: %v", name, domain, cert.DomainStatus))
+	default:
+		status.setCondition(ConditionCertificateReady, corev1.ConditionFalse, "ProvisioningFailed", fmt.Sprintf("Managed certificate %s status: %s, domain status: %v", name, cert.Status, cert.DomainStatus))
+		if prevStatus != cert.Status {
+			recordEvent(parent, corev1.EventTypeWarning, "CertificateProvisioningFailed", "Managed certificate %s status: %s, domain status: %v", name, cert.Status, cert.DomainStatus)
+		}
+	}
+}
+
+// syncCertificateIngress adds the certificate to the pre-shared-cert annotation of the target Ingress when spec.managedCertificate.annotateIngress is set,
+// and removes it from a previously annotated Ingress.
+func syncCertificateIngress(ctx context.Context, parent *CloudEndpoint, cert *CloudEndpointCertificateStatus) error {
+	desired := ""
+	if parent.Spec.ManagedCertificate.AnnotateIngress && parent.Spec.TargetIngress.Name != "" {
+		spec := targetIngressSpec(parent)
+		if targetIngressKind(spec) != TargetKindIngress {
+			return fmt.Errorf("managedCertificate.annotateIngress is only supported with targetIngress kind %s", TargetKindIngress)
+		}
+		if err := checkReference(parent, TargetKindIngress, spec.Namespace, spec.Name); err != nil {
+			return err
+		}
+		desired = spec.Namespace + "/" + spec.Name
+	}
+	if cert.Ingress == desired {
+		return nil
+	}
+	if cert.Ingress != "" {
+		if err := patchIngressCertificates(ctx, cert.Ingress, cert.Name, false); err != nil {
+			return err
+		}
+		cert.Ingress = ""
+	}
+	if desired != "" {
+		if err := patchIngressCertificates(ctx, desired, cert.Name, true); err != nil {
+			return err
+		}
+		cert.Ingress = desired
+		recordEvent(parent, corev1.EventTypeNormal, "IngressAnnotated", "Added managed certificate %s to Ingress %s", cert.Name, desired)
+	}
+	return nil
+}
+
+// patchIngressCertificates adds or removes the certificate name in the pre-shared-cert annotation of the Ingress with the given namespace/name key.
+// The other certificates in the annotation are kept.
+func patchIngressCertificates(ctx context.Context, key, certName string, add bool) error {
+	annotations, err := getIngressAnnotations(key)
+	if err != nil {
+		if apierrors.IsNotFound(err) && add == false {
+			return nil
+		}
+		return err
+	}
+
+	certs := make([]string, 0)
+	found := false
+	for _, c := range strings.Split(annotations[preSharedCertAnnotation], ",") {
+		if c = strings.TrimSpace(c); c == "" {
+			continue
+		}
+		if c == certName {
+			found = true
+			if add == false {
+				continue
+			}
+		}
+		certs = append(certs, c)
+	}
+	if found == add {
+		return nil
+	}
+	if add {
+		certs = append(certs, certName)
+	}
+
+	var value interface{}
+	if len(certs) > 0 {
+		value = strings.Join(certs, ",")
+	}
+	loggerFrom(ctx).WithField("ingress", key).WithField("certificates", certs).Info("Patching Ingress pre-shared-cert annotation")
+	return patchIngressAnnotation(key, preSharedCertAnnotation, value)
+}
+
+// releaseManagedCertificate removes the certificate from the annotated Ingress and deletes it if it was created by the controller.
+// Deleting fails while the certificate is still used by a load balancer, the caller retries on the next sync.
+func releaseManagedCertificate(ctx context.Context, parent *CloudEndpoint, status *CloudEndpointControllerStatus) error {
+	cert := status.Certificate
+	if cert.Ingress != "" {
+		if err := patchIngressCertificates(ctx, cert.Ingress, cert.Name, false); err != nil {
+			return err
+		}
+		cert.Ingress = ""
+	}
+	if cert.Created {
+		loggerFrom(ctx).WithField("certificate", cert.Name).Info("Deleting managed certificate")
+		if _, err := config.clientCompute.DeleteSslCertificate(ctx, parent.Spec.Project, cert.Name); err != nil {
+			if computeNotFound(err) == false {
+				return fmt.Errorf("Failed to delete managed certificate %s: %v", cert.Name, err)
+			}
+		} else {
+			recordEvent(parent, corev1.EventTypeNormal, "CertificateDeleted", "Deleted managed certificate %s", cert.Name)
+		}
+	}
+	status.Certificate = nil
+	return nil
+}
+
+// computeNotFound returns true if the Compute API reported the resource as missing.
+func computeNotFound(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && gerr.Code == http.StatusNotFound
+}
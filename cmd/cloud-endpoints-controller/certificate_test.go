@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+
+	computebeta "google.golang.org/api/compute/v0.beta"
+)
+
+func seedCertificate(env *testEnv, parent *CloudEndpoint, created bool) {
+	env.compute.sslCertificates[testComputeName] = &computebeta.SslCertificate{
+		Name:    testComputeName,
+		Managed: &computebeta.SslCertificateManagedSslCertificate{Domains: []string{testEndpoint}, Status: "ACTIVE"},
+	}
+	parent.Status.Certificate = &CloudEndpointCertificateStatus{Name: testComputeName, Domain: testEndpoint, Status: "ACTIVE", Created: created}
+}
+
+func TestSyncManagedCertificate(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name:       "managed certificate is created",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.ManagedCertificate = &CloudEndpointManagedCertificate{} },
+			syncs:      1,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionCertificateReady: "Provisioning"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Certificate == nil || status.Certificate.Created == false {
+					t.Errorf("certificate status = %+v, want created", status.Certificate)
+				}
+				if cert, ok := env.compute.sslCertificates[testComputeName]; ok == false || cert.Managed.Domains[0] != testEndpoint {
+					t.Errorf("managed certificate %s not created for %s", testComputeName, testEndpoint)
+				}
+			},
+		},
+		{
+			name: "existing managed certificate for the endpoint is adopted",
+			spec: func(parent *CloudEndpoint) { parent.Spec.ManagedCertificate = &CloudEndpointManagedCertificate{} },
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.compute.sslCertificates[testComputeName] = &computebeta.SslCertificate{
+					Name:    testComputeName,
+					Managed: &computebeta.SslCertificateManagedSslCertificate{Domains: []string{testEndpoint}, Status: "ACTIVE"},
+				}
+			},
+			syncs:      1,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionCertificateReady: "Active"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Certificate == nil || status.Certificate.Created {
+					t.Errorf("certificate status = %+v, want not created", status.Certificate)
+				}
+			},
+		},
+		{
+			name: "existing managed certificate for another domain is not adopted",
+			spec: func(parent *CloudEndpoint) { parent.Spec.ManagedCertificate = &CloudEndpointManagedCertificate{} },
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.compute.sslCertificates[testComputeName] = &computebeta.SslCertificate{
+					Name:    testComputeName,
+					Managed: &computebeta.SslCertificateManagedSslCertificate{Domains: []string{"www.example.com"}, Status: "ACTIVE"},
+				}
+			},
+			syncs:      1,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionCertificateReady: "DomainMismatch"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Certificate == nil || status.Certificate.Created || status.Certificate.Status != "" {
+					t.Errorf("certificate status = %+v, want not created and no status", status.Certificate)
+				}
+			},
+		},
+		{
+			name:  "removed managed certificate created by the controller is deleted",
+			spec:  func(parent *CloudEndpoint) { parent.Spec.ManagedCertificate = &CloudEndpointManagedCertificate{} },
+			syncs: 1,
+			update: func(parent *CloudEndpoint) {
+				parent.Spec.ManagedCertificate = nil
+			},
+			resyncs: 1,
+			state:   StateEndpointSubmitPending,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.compute.sslCertificates[testComputeName]; ok || status.Certificate != nil || status.getCondition(ConditionCertificateReady) != nil {
+					t.Errorf("managed certificate not released, status = %+v", status.Certificate)
+				}
+			},
+		},
+	})
+}
+
+func TestFinalizeManagedCertificate(t *testing.T) {
+	runFinalizeTests(t, []finalizeTest{
+		{
+			name:      "managed certificate created by the controller is deleted",
+			policy:    DeletionPolicyDelete,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env); seedCertificate(env, parent, true) },
+			calls:     2,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.compute.sslCertificates[testComputeName]; ok {
+					t.Errorf("managed certificate %s not deleted", testComputeName)
+				}
+			},
+		},
+		{
+			name:      "adopted managed certificate is kept",
+			policy:    DeletionPolicyDelete,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env); seedCertificate(env, parent, false) },
+			calls:     2,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.compute.sslCertificates[testComputeName]; ok == false {
+					t.Errorf("managed certificate %s deleted", testComputeName)
+				}
+			},
+		},
+	})
+}
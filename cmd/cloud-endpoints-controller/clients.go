@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+)
+
+// ServiceManager is the subset of the Service Management API used by the controller.
+type ServiceManager interface {
+	GetService(ctx context.Context, serviceName string) (*servicemanagement.ManagedService, error)
+	CreateService(ctx context.Context, service *servicemanagement.ManagedService) (*servicemanagement.Operation, error)
+	DeleteService(ctx context.Context, serviceName string) (*servicemanagement.Operation, error)
+	UndeleteService(ctx context.Context, serviceName string) (*servicemanagement.Operation, error)
+	GetConfig(ctx context.Context, serviceName, configID string) (*servicemanagement.Service, error)
+	ListConfigs(ctx context.Context, serviceName string) ([]*servicemanagement.Service, error)
+	SubmitConfig(ctx context.Context, serviceName string, req *servicemanagement.SubmitConfigSourceRequest) (*servicemanagement.Operation, error)
+	ListRollouts(ctx context.Context, serviceName string) ([]*servicemanagement.Rollout, error)
+	CreateRollout(ctx context.Context, serviceName string, rollout *servicemanagement.Rollout) (*servicemanagement.Operation, error)
+	GetOperation(ctx context.Context, name string) (*servicemanagement.Operation, error)
+}
+
+// ComputeClient is the subset of the Compute Engine API used by the controller.
+// SSL certificates use the beta API, managed certificates are not available in v1.
+type ComputeClient interface {
+	GetBackendService(ctx context.Context, project, name string) (*compute.BackendService, error)
+	GetSslCertificate(ctx context.Context, project, name string) (*computebeta.SslCertificate, error)
+	InsertSslCertificate(ctx context.Context, project string, cert *computebeta.SslCertificate) (*computebeta.Operation, error)
+	DeleteSslCertificate(ctx context.Context, project, name string) (*computebeta.Operation, error)
+	GetGlobalAddress(ctx context.Context, project, name string) (*compute.Address, error)
+	InsertGlobalAddress(ctx context.Context, project string, address *compute.Address) (*compute.Operation, error)
+	DeleteGlobalAddress(ctx context.Context, project, name string) (*compute.Operation, error)
+}
+
+// serviceManagerClient implements ServiceManager with the Service Management API client.
+type serviceManagerClient struct {
+	svc *servicemanagement.APIService
+}
+
+func (c *serviceManagerClient) GetService(ctx context.Context, serviceName string) (*servicemanagement.ManagedService, error) {
+	r, err := c.svc.Services.Get(serviceName).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.get", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) CreateService(ctx context.Context, service *servicemanagement.ManagedService) (*servicemanagement.Operation, error) {
+	r, err := c.svc.Services.Create(service).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.create", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) DeleteService(ctx context.Context, serviceName string) (*servicemanagement.Operation, error) {
+	r, err := c.svc.Services.Delete(serviceName).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.delete", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) UndeleteService(ctx context.Context, serviceName string) (*servicemanagement.Operation, error) {
+	r, err := c.svc.Services.Undelete(serviceName).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.undelete", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) GetConfig(ctx context.Context, serviceName, configID string) (*servicemanagement.Service, error) {
+	r, err := c.svc.Services.Configs.Get(serviceName, configID).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.configs.get", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) ListConfigs(ctx context.Context, serviceName string) ([]*servicemanagement.Service, error) {
+	configs := make([]*servicemanagement.Service, 0)
+	err := c.svc.Services.Configs.List(serviceName).Pages(ctx, func(r *servicemanagement.ListServiceConfigsResponse) error {
+		configs = append(configs, r.ServiceConfigs...)
+		return nil
+	})
+	observeAPICall(ctx, "servicemanagement", "services.configs.list", err)
+	return configs, err
+}
+
+func (c *serviceManagerClient) SubmitConfig(ctx context.Context, serviceName string, req *servicemanagement.SubmitConfigSourceRequest) (*servicemanagement.Operation, error) {
+	r, err := c.svc.Services.Configs.Submit(serviceName, req).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.configs.submit", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) ListRollouts(ctx context.Context, serviceName string) ([]*servicemanagement.Rollout, error) {
+	r, err := c.svc.Services.Rollouts.List(serviceName).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.rollouts.list", err)
+	if err != nil {
+		return nil, err
+	}
+	return r.Rollouts, nil
+}
+
+func (c *serviceManagerClient) CreateRollout(ctx context.Context, serviceName string, rollout *servicemanagement.Rollout) (*servicemanagement.Operation, error) {
+	r, err := c.svc.Services.Rollouts.Create(serviceName, rollout).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "services.rollouts.create", err)
+	return r, err
+}
+
+func (c *serviceManagerClient) GetOperation(ctx context.Context, name string) (*servicemanagement.Operation, error) {
+	r, err := c.svc.Operations.Get(name).Context(ctx).Do()
+	observeAPICall(ctx, "servicemanagement", "operations.get", err)
+	return r, err
+}
+
+// computeClient implements ComputeClient with the Compute Engine API clients.
+type computeClient struct {
+	svc     *compute.Service
+	betaSvc *computebeta.Service
+}
+
+func (c *computeClient) GetBackendService(ctx context.Context, project, name string) (*compute.BackendService, error) {
+	r, err := c.svc.BackendServices.Get(project, name).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "backendServices.get", err)
+	return r, err
+}
+
+func (c *computeClient) GetSslCertificate(ctx context.Context, project, name string) (*computebeta.SslCertificate, error) {
+	r, err := c.betaSvc.SslCertificates.Get(project, name).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "sslCertificates.get", err)
+	return r, err
+}
+
+func (c *computeClient) InsertSslCertificate(ctx context.Context, project string, cert *computebeta.SslCertificate) (*computebeta.Operation, error) {
+	r, err := c.betaSvc.SslCertificates.Insert(project, cert).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "sslCertificates.insert", err)
+	return r, err
+}
+
+func (c *computeClient) DeleteSslCertificate(ctx context.Context, project, name string) (*computebeta.Operation, error) {
+	r, err := c.betaSvc.SslCertificates.Delete(project, name).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "sslCertificates.delete", err)
+	return r, err
+}
+
+func (c *computeClient) GetGlobalAddress(ctx context.Context, project, name string) (*compute.Address, error) {
+	r, err := c.svc.GlobalAddresses.Get(project, name).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "globalAddresses.get", err)
+	return r, err
+}
+
+func (c *computeClient) InsertGlobalAddress(ctx context.Context, project string, address *compute.Address) (*compute.Operation, error) {
+	r, err := c.svc.GlobalAddresses.Insert(project, address).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "globalAddresses.insert", err)
+	return r, err
+}
+
+func (c *computeClient) DeleteGlobalAddress(ctx context.Context, project, name string) (*compute.Operation, error) {
+	r, err := c.svc.GlobalAddresses.Delete(project, name).Context(ctx).Do()
+	observeAPICall(ctx, "compute", "globalAddresses.delete", err)
+	return r, err
+}
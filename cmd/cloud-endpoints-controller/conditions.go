@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// setCondition adds or updates the condition of the given type. The lastTransitionTime is only changed when the condition status changes.
+func (s *CloudEndpointControllerStatus) setCondition(condType CloudEndpointConditionType, condStatus corev1.ConditionStatus, reason, message string) {
+	if condStatus == corev1.ConditionFalse && condType != ConditionReady {
+		s.lastReason = reason
+	}
+	for i := range s.Conditions {
+		c := &s.Conditions[i]
+		if c.Type != condType {
+			continue
+		}
+		if c.Status != condStatus {
+			c.LastTransitionTime = metav1.Now()
+		}
+		c.Status = condStatus
+		c.Reason = reason
+		c.Message = message
+		return
+	}
+	s.Conditions = append(s.Conditions, CloudEndpointCondition{
+		Type:               condType,
+		Status:             condStatus,
+		Reason:             reason,
+		Message:            message,
+		LastTransitionTime: metav1.Now(),
+	})
+}
+
+// getCondition returns the condition of the given type, or nil if it has not been set.
+func (s *CloudEndpointControllerStatus) getCondition(condType CloudEndpointConditionType) *CloudEndpointCondition {
+	for i := range s.Conditions {
+		if s.Conditions[i].Type == condType {
+			return &s.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// removeCondition removes the condition of the given type.
+func (s *CloudEndpointControllerStatus) removeCondition(condType CloudEndpointConditionType) {
+	conditions := make([]CloudEndpointCondition, 0, len(s.Conditions))
+	for _, c := range s.Conditions {
+		if c.Type != condType {
+			conditions = append(conditions, c)
+		}
+	}
+	s.Conditions = conditions
+}
+
+// isConditionTrue returns true if the condition of the given type is set and has status True.
+func (s *CloudEndpointControllerStatus) isConditionTrue(condType CloudEndpointConditionType) bool {
+	c := s.getCondition(condType)
+	return c != nil && c.Status == corev1.ConditionTrue
+}
+
+// updateReadyCondition derives the Ready condition from the sync result and the other conditions.
+func updateReadyCondition(status *CloudEndpointControllerStatus, err error) {
+	switch {
+	case status.StateCurrent == StateFailed:
+		status.setCondition(ConditionReady, corev1.ConditionFalse, "Failed", fmt.Sprintf("Gave up after %d attempts: %s", status.FailedAttempts, status.LastError))
+	case status.StateCurrent == StateBackoff && status.NextRetryTime != nil:
+		status.setCondition(ConditionReady, corev1.ConditionFalse, "Backoff", fmt.Sprintf("Retrying at %s after error: %s", status.NextRetryTime.UTC().Format(time.RFC3339), status.LastError))
+	case err != nil:
+		status.setCondition(ConditionReady, corev1.ConditionFalse, "SyncError", err.Error())
+	case status.StateCurrent == StateIdle && status.getCondition(ConditionConfigSubmitted) != nil && status.getCondition(ConditionConfigSubmitted).Reason == "DryRun":
+		status.setCondition(ConditionReady, corev1.ConditionFalse, "DryRun", status.getCondition(ConditionConfigSubmitted).Message)
+	case status.StateCurrent == StateIdle && status.RolloutAborted:
+		status.setCondition(ConditionReady, corev1.ConditionFalse, "RolloutAborted", status.getCondition(ConditionRolloutComplete).Message)
+	case status.StateCurrent == StateIdle && status.isConditionTrue(ConditionRolloutComplete):
+		status.setCondition(ConditionReady, corev1.ConditionTrue, "RolloutComplete", fmt.Sprintf("Config %s is serving on %s", status.Config, status.Endpoint))
+	default:
+		status.setCondition(ConditionReady, corev1.ConditionFalse, "Progressing", fmt.Sprintf("Current state: %s", status.StateCurrent))
+	}
+}
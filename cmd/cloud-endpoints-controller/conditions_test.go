@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSetCondition(t *testing.T) {
+	status := &CloudEndpointControllerStatus{}
+	status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "SubmitPending", "waiting")
+	status.setCondition(ConditionReady, corev1.ConditionFalse, "Progressing", "waiting")
+	if status.lastReason != "SubmitPending" {
+		t.Errorf("lastReason = %s, want SubmitPending", status.lastReason)
+	}
+
+	past := metav1.NewTime(time.Now().Add(-time.Hour))
+	status.Conditions[0].LastTransitionTime = past
+	status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "SubmitPending", "still waiting")
+	if c := status.getCondition(ConditionConfigSubmitted); c.LastTransitionTime != past || c.Message != "still waiting" {
+		t.Errorf("condition = %+v, want message updated without a transition", c)
+	}
+
+	status.setCondition(ConditionConfigSubmitted, corev1.ConditionTrue, "ConfigSubmitted", "2018-01-01r0")
+	if c := status.getCondition(ConditionConfigSubmitted); c.LastTransitionTime == past || status.isConditionTrue(ConditionConfigSubmitted) == false {
+		t.Errorf("condition = %+v, want a transition to True", c)
+	}
+	if len(status.Conditions) != 2 {
+		t.Errorf("%d conditions, want 2", len(status.Conditions))
+	}
+
+	status.removeCondition(ConditionConfigSubmitted)
+	if status.getCondition(ConditionConfigSubmitted) != nil || len(status.Conditions) != 1 {
+		t.Errorf("conditions = %+v, want only Ready", status.Conditions)
+	}
+}
+
+func TestUpdateReadyCondition(t *testing.T) {
+	retry := metav1.NewTime(time.Now().Add(time.Minute))
+	tests := []struct {
+		name   string
+		status CloudEndpointControllerStatus
+		err    error
+		reason string
+		ready  corev1.ConditionStatus
+	}{
+		{
+			name:   "failed",
+			status: CloudEndpointControllerStatus{StateCurrent: StateFailed},
+			reason: "Failed",
+			ready:  corev1.ConditionFalse,
+		},
+		{
+			name:   "backoff",
+			status: CloudEndpointControllerStatus{StateCurrent: StateBackoff, NextRetryTime: &retry},
+			reason: "Backoff",
+			ready:  corev1.ConditionFalse,
+		},
+		{
+			name:   "sync error",
+			status: CloudEndpointControllerStatus{StateCurrent: StateEndpointSubmitPending},
+			err:    fmt.Errorf("failed"),
+			reason: "SyncError",
+			ready:  corev1.ConditionFalse,
+		},
+		{
+			name: "rollout complete",
+			status: CloudEndpointControllerStatus{StateCurrent: StateIdle, Conditions: []CloudEndpointCondition{
+				{Type: ConditionRolloutComplete, Status: corev1.ConditionTrue, Reason: "RolloutComplete"},
+			}},
+			reason: "RolloutComplete",
+			ready:  corev1.ConditionTrue,
+		},
+		{
+			name:   "progressing",
+			status: CloudEndpointControllerStatus{StateCurrent: StateEndpointRolloutPending},
+			reason: "Progressing",
+			ready:  corev1.ConditionFalse,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			status := tc.status
+			updateReadyCondition(&status, tc.err)
+			c := status.getCondition(ConditionReady)
+			if c == nil || c.Reason != tc.reason || c.Status != tc.ready {
+				t.Errorf("ready condition = %+v, want %s with reason %s", c, tc.ready, tc.reason)
+			}
+		})
+	}
+}
@@ -1,48 +1,162 @@
 package main
 
 import (
-	"log"
-	"strings"
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
 
 	"cloud.google.com/go/compute/metadata"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
+	cloudresourcemanager "google.golang.org/api/cloudresourcemanager/v1"
+	computebeta "google.golang.org/api/compute/v0.beta"
 	"google.golang.org/api/compute/v1"
 	"google.golang.org/api/servicemanagement/v1"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 // Config is the configuration structure used by the LambdaController
 type Config struct {
-	Project          string
-	ProjectNum       string
-	clientCompute    *compute.Service
-	clientServiceMan *servicemanagement.APIService
-	clientset        *kubernetes.Clientset
-	serviceAccount   string
+	Project                 string
+	ProjectNum              string
+	KubeConfig              string
+	CredentialsFile         string
+	ListenAddress           string
+	LogLevel                string
+	Mode                    string
+	Workers                 int
+	LeaderElect             bool
+	LeaderElectionNamespace string
+	LeaderElectionID        string
+	AllowCrossNamespaceRefs bool
+	OpenAPIURLAllowlist     string
+	StaleConfigLimit        int
+	clientCompute           ComputeClient
+	clientServiceMan        ServiceManager
+	clientset               kubernetes.Interface
+	dynamicClient           dynamic.Interface
+	clusterConfig           *rest.Config
+	listers                 *kubeListers
+	identity                string
+	recorder                record.EventRecorder
+	serviceAccount          string
+}
+
+// registerFlags binds the config fields to command line flags. The default of every flag is read from its environment variable.
+func (c *Config) registerFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.Project, "project", os.Getenv("PROJECT_ID"), "Google Cloud project ID, env PROJECT_ID. Defaults to the metadata server or the credentials project.")
+	fs.StringVar(&c.ProjectNum, "project-number", os.Getenv("PROJECT_NUMBER"), "Google Cloud project number, env PROJECT_NUMBER. Defaults to the metadata server or the Cloud Resource Manager API.")
+	fs.StringVar(&c.KubeConfig, "kubeconfig", os.Getenv("KUBECONFIG"), "Path to a kubeconfig file, env KUBECONFIG. Defaults to the in-cluster config.")
+	fs.StringVar(&c.CredentialsFile, "credentials", os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"), "Path to a service account JSON key file, env GOOGLE_APPLICATION_CREDENTIALS. Defaults to the application default credentials.")
+	fs.StringVar(&c.ListenAddress, "listen-address", envOrDefault("LISTEN_ADDRESS", ":80"), "Address of the webhook HTTP server, env LISTEN_ADDRESS.")
+	fs.StringVar(&c.Mode, "mode", envOrDefault("CONTROLLER_MODE", ModeMetacontroller), "Controller mode, metacontroller to serve the CompositeController hooks or standalone to watch CloudEndpoints directly, env CONTROLLER_MODE.")
+	fs.IntVar(&c.Workers, "workers", 2, "Number of CloudEndpoints synced in parallel in standalone mode.")
+	fs.BoolVar(&c.LeaderElect, "leader-elect", envOrDefault("LEADER_ELECT", "true") == "true", "Elect a leader with a Lease in standalone mode and take a Lease per CloudEndpoint in metacontroller mode, env LEADER_ELECT.")
+	fs.StringVar(&c.LeaderElectionNamespace, "leader-election-namespace", envOrDefault("POD_NAMESPACE", "default"), "Namespace of the leader election Lease, env POD_NAMESPACE.")
+	fs.StringVar(&c.LeaderElectionID, "leader-election-id", "cloud-endpoints-controller", "Name of the leader election Lease.")
+	fs.BoolVar(&c.AllowCrossNamespaceRefs, "allow-cross-namespace-refs", envOrDefault("ALLOW_CROSS_NAMESPACE_REFS", "false") == "true", "Allow CloudEndpoints to reference Ingresses and Services in any namespace without the "+allowReferencesAnnotation+" namespace annotation, env ALLOW_CROSS_NAMESPACE_REFS.")
+	fs.StringVar(&c.OpenAPIURLAllowlist, "openapi-url-allowlist", os.Getenv("OPENAPI_URL_ALLOWLIST"), "Comma separated list of hosts or URL prefixes that openAPISpecFrom URL sources may be downloaded from, env OPENAPI_URL_ALLOWLIST. URL sources are rejected when empty.")
+	fs.IntVar(&c.StaleConfigLimit, "stale-config-limit", envIntOrDefault("STALE_CONFIG_LIMIT", 0), "Report the number of service configs above this limit in status.staleConfigCount after every rollout, env STALE_CONFIG_LIMIT. Defaults to 0, which does not list the configs.")
+	fs.StringVar(&c.LogLevel, "log-level", envOrDefault("LOG_LEVEL", "info"), "Log level, one of debug, info, warn or error, env LOG_LEVEL.")
+}
+
+func envOrDefault(key, defaultValue string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return defaultValue
+}
+
+func envIntOrDefault(key string, defaultValue int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return defaultValue
 }
 
 func (c *Config) loadAndValidate() error {
 	var err error
 
-	if c.Project == "" {
-		log.Printf("[INFO] Fetching Project ID from Compute metadata API...")
+	ctx := context.Background()
+	onGCE := metadata.OnGCE()
+
+	clientScopes := []string{
+		compute.ComputeScope,
+		servicemanagement.ServiceManagementScope,
+		cloudresourcemanager.CloudPlatformReadOnlyScope,
+	}
+
+	var creds *google.Credentials
+	if c.CredentialsFile != "" {
+		rootLogger.WithField("credentials", c.CredentialsFile).Info("Loading credentials from file")
+		data, err := ioutil.ReadFile(c.CredentialsFile)
+		if err != nil {
+			return err
+		}
+		creds, err = google.CredentialsFromJSON(ctx, data, clientScopes...)
+		if err != nil {
+			return err
+		}
+	} else {
+		creds, err = google.FindDefaultCredentials(ctx, clientScopes...)
+		if err != nil {
+			return err
+		}
+	}
+	client := oauth2.NewClient(ctx, creds.TokenSource)
+
+	if c.Project == "" && onGCE {
+		rootLogger.Info("Fetching Project ID from Compute metadata API")
 		c.Project, err = metadata.ProjectID()
 		if err != nil {
 			return err
 		}
 	}
 
-	if c.ProjectNum == "" {
-		log.Printf("[INFO] Fetching Numeric Project ID from Compute metadata API...")
+	if c.Project == "" && creds.ProjectID != "" {
+		rootLogger.WithField("project", creds.ProjectID).Info("Using Project ID from credentials")
+		c.Project = creds.ProjectID
+	}
+
+	if c.Project == "" {
+		return fmt.Errorf("Project ID could not be determined, set --project or PROJECT_ID")
+	}
+
+	if c.ProjectNum == "" && onGCE {
+		rootLogger.Info("Fetching Numeric Project ID from Compute metadata API")
 		c.ProjectNum, err = metadata.NumericProjectID()
 		if err != nil {
 			return err
 		}
 	}
 
-	clusterConfig, err := rest.InClusterConfig()
+	if c.ProjectNum == "" {
+		rootLogger.Info("Fetching Numeric Project ID from Cloud Resource Manager API")
+		crm, err := cloudresourcemanager.New(client)
+		if err != nil {
+			return err
+		}
+		project, err := crm.Projects.Get(c.Project).Do()
+		if err != nil {
+			return fmt.Errorf("Failed to get project number for project %s, set --project-number or PROJECT_NUMBER: %v", c.Project, err)
+		}
+		c.ProjectNum = strconv.FormatInt(project.ProjectNumber, 10)
+	}
+
+	var clusterConfig *rest.Config
+	if c.KubeConfig != "" {
+		rootLogger.WithField("kubeconfig", c.KubeConfig).Info("Using kubeconfig")
+		clusterConfig, err = clientcmd.BuildConfigFromFlags("", c.KubeConfig)
+	} else {
+		clusterConfig, err = rest.InClusterConfig()
+	}
 	if err != nil {
 		return err
 	}
@@ -52,25 +166,30 @@ func (c *Config) loadAndValidate() error {
 		return err
 	}
 	c.clientset = clientset
-
-	clientScopes := []string{
-		compute.ComputeScope,
-		servicemanagement.ServiceManagementScope,
+	c.dynamicClient, err = dynamic.NewForConfig(clusterConfig)
+	if err != nil {
+		return err
 	}
+	c.clusterConfig = clusterConfig
+	c.recorder = newEventRecorder(clientset)
 
-	client, err := google.DefaultClient(oauth2.NoContext, strings.Join(clientScopes, " "))
+	rootLogger.Info("Instantiating GCE client")
+	computeService, err := compute.New(client)
 	if err != nil {
 		return err
 	}
+	computeBetaService, err := computebeta.New(client)
+	if err != nil {
+		return err
+	}
+	c.clientCompute = &computeClient{computeService, computeBetaService}
 
-	log.Printf("[INFO] Instantiating GCE client...")
-	c.clientCompute, err = compute.New(client)
-
-	log.Printf("[INFO] Instantiating Google Cloud Service Management Client...")
-	c.clientServiceMan, err = servicemanagement.New(client)
+	rootLogger.Info("Instantiating Google Cloud Service Management client")
+	serviceManService, err := servicemanagement.New(client)
 	if err != nil {
 		return err
 	}
+	c.clientServiceMan = &serviceManagerClient{serviceManService}
 
 	return nil
 }
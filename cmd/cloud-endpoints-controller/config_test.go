@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"testing"
+)
+
+func TestRegisterFlags(t *testing.T) {
+	env := map[string]string{
+		"PROJECT_ID":         "env-project",
+		"LISTEN_ADDRESS":     ":9090",
+		"LEADER_ELECT":       "false",
+		"STALE_CONFIG_LIMIT": "not a number",
+	}
+	for k, v := range env {
+		prev, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		if ok {
+			defer os.Setenv(k, prev)
+		} else {
+			defer os.Unsetenv(k)
+		}
+	}
+
+	var c Config
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	c.registerFlags(fs)
+	if err := fs.Parse([]string{"--listen-address", ":8080", "--workers", "4"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	if c.Project != "env-project" {
+		t.Errorf("project = %s, want the PROJECT_ID default", c.Project)
+	}
+	if c.ListenAddress != ":8080" || c.Workers != 4 {
+		t.Errorf("listenAddress = %s, workers = %d, want the flag values", c.ListenAddress, c.Workers)
+	}
+	if c.LeaderElect || c.Mode != ModeMetacontroller || c.StaleConfigLimit != 0 {
+		t.Errorf("leaderElect = %v, mode = %s, staleConfigLimit = %d", c.LeaderElect, c.Mode, c.StaleConfigLimit)
+	}
+}
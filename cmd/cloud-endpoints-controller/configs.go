@@ -0,0 +1,31 @@
+package main
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reportStaleConfigs records the number of stored service configs and the number exceeding the --stale-config-limit flag.
+// The Service Management API has no method to delete individual configs, so stale configs are reported but not pruned.
+func reportStaleConfigs(ctx context.Context, status *CloudEndpointControllerStatus) {
+	limit := config.StaleConfigLimit
+	if limit <= 0 {
+		status.ServiceConfigCount = 0
+		status.StaleConfigCount = 0
+		return
+	}
+	configs, err := config.clientServiceMan.ListConfigs(ctx, status.Endpoint)
+	if err != nil {
+		loggerFrom(ctx).WithError(err).Warn("Failed to list service configs")
+		return
+	}
+	count := len(configs)
+	status.ServiceConfigCount = count
+	status.StaleConfigCount = 0
+
+	if count > limit {
+		status.StaleConfigCount = count - limit
+		loggerFrom(ctx).WithFields(logrus.Fields{"configs": count, "staleConfigs": status.StaleConfigCount, "staleConfigLimit": limit}).Warn("Endpoint has more service configs than the stale config limit")
+	}
+}
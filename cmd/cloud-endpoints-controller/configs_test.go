@@ -0,0 +1,52 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+)
+
+func TestSyncConfigs(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name:    "identical rendered config is not submitted again",
+			syncs:   4,
+			update:  func(parent *CloudEndpoint) { parent.Spec.ConfigHistoryLimit = 5 },
+			resyncs: 4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(env.sm.submitted) != 1 || status.Config != "2018-01-01r0" || len(status.ConfigHistory) != 1 {
+					t.Errorf("%d configs submitted, config = %s, history = %v", len(env.sm.submitted), status.Config, status.ConfigHistory)
+				}
+			},
+		},
+		{
+			name: "stale configs are not listed without a limit",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["ListConfigs"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.errors["ListConfigs"]; ok == false || status.ServiceConfigCount != 0 {
+					t.Errorf("configs listed, serviceConfigCount = %d", status.ServiceConfigCount)
+				}
+			},
+		},
+		{
+			name: "stale configs above the limit are reported after the rollout",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				seedServingConfig(env)
+				config.StaleConfigLimit = 1
+			},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.ServiceConfigCount != 2 || status.StaleConfigCount != 1 {
+					t.Errorf("serviceConfigCount = %d, staleConfigCount = %d, want 2, 1", status.ServiceConfigCount, status.StaleConfigCount)
+				}
+			},
+		},
+	})
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/rest"
+)
+
+const cloudEndpointsResource = "cloudendpoints"
+
+// schemeGroupVersion is the API group and version of the CloudEndpoint custom resource.
+var schemeGroupVersion = schema.GroupVersion{Group: "ctl.isla.solutions", Version: "v1"}
+
+var (
+	crdScheme = runtime.NewScheme()
+	crdCodecs = serializer.NewCodecFactory(crdScheme)
+)
+
+func init() {
+	crdScheme.AddKnownTypes(schemeGroupVersion, &CloudEndpoint{}, &CloudEndpointList{})
+	metav1.AddToGroupVersion(crdScheme, schemeGroupVersion)
+}
+
+// CloudEndpointList is a list of CloudEndpoint resources.
+type CloudEndpointList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []CloudEndpoint `json:"items"`
+}
+
+// cloudEndpointClient is a REST client for the CloudEndpoint custom resource.
+type cloudEndpointClient struct {
+	rest rest.Interface
+}
+
+func newCloudEndpointClient(clusterConfig *rest.Config) (*cloudEndpointClient, error) {
+	c := *clusterConfig
+	c.GroupVersion = &schemeGroupVersion
+	c.APIPath = "/apis"
+	c.ContentType = runtime.ContentTypeJSON
+	c.NegotiatedSerializer = serializer.DirectCodecFactory{CodecFactory: crdCodecs}
+	if c.UserAgent == "" {
+		c.UserAgent = rest.DefaultKubernetesUserAgent()
+	}
+	restClient, err := rest.RESTClientFor(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &cloudEndpointClient{rest: restClient}, nil
+}
+
+func (c *cloudEndpointClient) List(namespace string, opts metav1.ListOptions) (*CloudEndpointList, error) {
+	result := &CloudEndpointList{}
+	err := c.rest.Get().
+		Namespace(namespace).
+		Resource(cloudEndpointsResource).
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Do().
+		Into(result)
+	return result, err
+}
+
+func (c *cloudEndpointClient) Watch(namespace string, opts metav1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.rest.Get().
+		Namespace(namespace).
+		Resource(cloudEndpointsResource).
+		VersionedParams(&opts, metav1.ParameterCodec).
+		Timeout(10 * time.Minute).
+		Watch()
+}
+
+func (c *cloudEndpointClient) Update(parent *CloudEndpoint) (*CloudEndpoint, error) {
+	result := &CloudEndpoint{}
+	err := c.rest.Put().
+		Namespace(parent.Namespace).
+		Resource(cloudEndpointsResource).
+		Name(parent.Name).
+		Body(parent).
+		Do().
+		Into(result)
+	return result, err
+}
+
+// UpdateStatus writes the status with the status subresource, the spec of the object is ignored by the API server.
+func (c *cloudEndpointClient) UpdateStatus(parent *CloudEndpoint) (*CloudEndpoint, error) {
+	result := &CloudEndpoint{}
+	err := c.rest.Put().
+		Namespace(parent.Namespace).
+		Resource(cloudEndpointsResource).
+		Name(parent.Name).
+		SubResource("status").
+		Body(parent).
+		Do().
+		Into(result)
+	return result, err
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyObject implements runtime.Object.
+func (in *CloudEndpoint) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopy returns a deep copy of the CloudEndpoint.
+func (in *CloudEndpoint) DeepCopy() *CloudEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto copies the CloudEndpoint into out.
+func (in *CloudEndpoint) DeepCopyInto(out *CloudEndpoint) {
+	*out = *in
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopyObject implements runtime.Object.
+func (in *CloudEndpointList) DeepCopyObject() runtime.Object {
+	if in == nil {
+		return nil
+	}
+	out := new(CloudEndpointList)
+	*out = *in
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]CloudEndpoint, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+	return out
+}
+
+// DeepCopyInto copies the CloudEndpointSpec into out.
+func (in *CloudEndpointSpec) DeepCopyInto(out *CloudEndpointSpec) {
+	*out = *in
+	out.TargetIngress.JWTServices = copyStrings(in.TargetIngress.JWTServices)
+	if in.TargetService != nil {
+		s := *in.TargetService
+		out.TargetService = &s
+	}
+	if in.OpenAPISpecFrom != nil {
+		out.OpenAPISpecFrom = make([]CloudEndpointOpenAPISpecSource, len(in.OpenAPISpecFrom))
+		for i, src := range in.OpenAPISpecFrom {
+			src.ConfigMap = copyConfigMapSpec(src.ConfigMap)
+			src.Secret = copySecretSpec(src.Secret)
+			out.OpenAPISpecFrom[i] = src
+		}
+	}
+	if in.GRPC != nil {
+		g := *in.GRPC
+		g.DescriptorSetConfigMap = copyConfigMapSpec(g.DescriptorSetConfigMap)
+		g.DescriptorSetSecret = copySecretSpec(g.DescriptorSetSecret)
+		g.ServiceConfigConfigMap = copyConfigMapSpec(g.ServiceConfigConfigMap)
+		out.GRPC = &g
+	}
+	if in.Rollout != nil {
+		r := *in.Rollout
+		if r.Steps != nil {
+			r.Steps = append([]CloudEndpointRolloutStep(nil), r.Steps...)
+		}
+		out.Rollout = &r
+	}
+	if in.ManagedCertificate != nil {
+		c := *in.ManagedCertificate
+		out.ManagedCertificate = &c
+	}
+	if in.StaticIP != nil {
+		ip := *in.StaticIP
+		out.StaticIP = &ip
+	}
+	if in.Authentication != nil {
+		a := *in.Authentication
+		if a.Providers != nil {
+			a.Providers = make([]CloudEndpointAuthProvider, len(in.Authentication.Providers))
+			for i, p := range in.Authentication.Providers {
+				p.Audiences = copyStrings(p.Audiences)
+				a.Providers[i] = p
+			}
+		}
+		out.Authentication = &a
+	}
+	if in.APIKeys != nil {
+		k := *in.APIKeys
+		k.Paths = copyStrings(k.Paths)
+		out.APIKeys = &k
+	}
+	if in.Quota != nil {
+		q := *in.Quota
+		if q.Metrics != nil {
+			q.Metrics = append([]CloudEndpointQuotaMetric(nil), q.Metrics...)
+		}
+		if q.Costs != nil {
+			q.Costs = make([]CloudEndpointQuotaCost, len(in.Quota.Costs))
+			for i, c := range in.Quota.Costs {
+				c.Paths = copyStrings(c.Paths)
+				c.Methods = copyStrings(c.Methods)
+				q.Costs[i] = c
+			}
+		}
+		out.Quota = &q
+	}
+	if in.Wildcard != nil {
+		w := *in.Wildcard
+		w.Methods = copyStrings(w.Methods)
+		out.Wildcard = &w
+	}
+}
+
+// DeepCopyInto copies the CloudEndpointControllerStatus into out.
+func (in *CloudEndpointControllerStatus) DeepCopyInto(out *CloudEndpointControllerStatus) {
+	*out = *in
+	out.JWTAudiences = copyStrings(in.JWTAudiences)
+	out.ValidationDiagnostics = copyStrings(in.ValidationDiagnostics)
+	out.NextRetryTime = in.NextRetryTime.DeepCopy()
+	out.RolloutStepTime = in.RolloutStepTime.DeepCopy()
+	out.StateTransitionTime = in.StateTransitionTime.DeepCopy()
+	if in.RolloutPercentages != nil {
+		out.RolloutPercentages = make(map[string]float64, len(in.RolloutPercentages))
+		for k, v := range in.RolloutPercentages {
+			out.RolloutPercentages[k] = v
+		}
+	}
+	if in.ConfigHistory != nil {
+		out.ConfigHistory = make([]CloudEndpointConfigHistory, len(in.ConfigHistory))
+		for i := range in.ConfigHistory {
+			in.ConfigHistory[i].DeepCopyInto(&out.ConfigHistory[i])
+		}
+	}
+	if in.Certificate != nil {
+		c := *in.Certificate
+		if c.DomainStatus != nil {
+			c.DomainStatus = make(map[string]string, len(in.Certificate.DomainStatus))
+			for k, v := range in.Certificate.DomainStatus {
+				c.DomainStatus[k] = v
+			}
+		}
+		c.CheckTime = in.Certificate.CheckTime.DeepCopy()
+		out.Certificate = &c
+	}
+	if in.StaticIP != nil {
+		ip := *in.StaticIP
+		ip.CheckTime = in.StaticIP.CheckTime.DeepCopy()
+		out.StaticIP = &ip
+	}
+	if in.Conditions != nil {
+		out.Conditions = make([]CloudEndpointCondition, len(in.Conditions))
+		for i := range in.Conditions {
+			in.Conditions[i].DeepCopyInto(&out.Conditions[i])
+		}
+	}
+}
+
+// DeepCopyInto copies the CloudEndpointCondition into out.
+func (in *CloudEndpointCondition) DeepCopyInto(out *CloudEndpointCondition) {
+	*out = *in
+	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
+}
+
+// DeepCopyInto copies the CloudEndpointConfigHistory into out.
+func (in *CloudEndpointConfigHistory) DeepCopyInto(out *CloudEndpointConfigHistory) {
+	*out = *in
+	in.SubmitTime.DeepCopyInto(&out.SubmitTime)
+}
+
+func copyStrings(in []string) []string {
+	if in == nil {
+		return nil
+	}
+	return append([]string{}, in...)
+}
+
+func copyConfigMapSpec(in *CloudEndpointConfigMapSpec) *CloudEndpointConfigMapSpec {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
+
+func copySecretSpec(in *CloudEndpointSecretSpec) *CloudEndpointSecretSpec {
+	if in == nil {
+		return nil
+	}
+	out := *in
+	return &out
+}
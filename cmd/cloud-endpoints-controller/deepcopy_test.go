@@ -0,0 +1,86 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCloudEndpointDeepCopy(t *testing.T) {
+	now := metav1.NewTime(time.Now())
+	in := newTestParent()
+	in.Labels = map[string]string{"app": "svc1"}
+	in.Spec.TargetIngress.JWTServices = []string{"svc1"}
+	in.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "svc1"}
+	in.Spec.OpenAPISpecFrom = []CloudEndpointOpenAPISpecSource{{ConfigMap: &CloudEndpointConfigMapSpec{Name: "spec", Key: "openapi.yaml"}}}
+	in.Spec.GRPC = &CloudEndpointGRPCSpec{DescriptorSetSecret: &CloudEndpointSecretSpec{Name: "proto", Key: "api.pb"}}
+	in.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10, Wait: "10m"}}}
+	in.Spec.Authentication = &CloudEndpointAuthentication{Providers: []CloudEndpointAuthProvider{{Name: "auth0", Audiences: []string{"aud"}}}}
+	in.Spec.APIKeys = &CloudEndpointAPIKeys{Paths: []string{"/v1/*"}}
+	in.Spec.Quota = &CloudEndpointQuota{Costs: []CloudEndpointQuotaCost{{Metric: "read", Cost: 1, Methods: []string{"get"}}}}
+	in.Spec.Wildcard = &CloudEndpointWildcard{Methods: []string{"get"}}
+	in.Status = CloudEndpointControllerStatus{
+		JWTAudiences:       []string{"aud"},
+		NextRetryTime:      &now,
+		RolloutPercentages: map[string]float64{"2018-01-01r0": 90},
+		ConfigHistory:      []CloudEndpointConfigHistory{{Config: "2018-01-01r0", SubmitTime: now}},
+		Certificate:        &CloudEndpointCertificateStatus{Name: "cert", DomainStatus: map[string]string{testEndpoint: "PROVISIONING"}},
+		StaticIP:           &CloudEndpointStaticIPStatus{Name: "ip", CheckTime: &now},
+		Conditions:         []CloudEndpointCondition{{Type: "Ready", LastTransitionTime: now}},
+	}
+
+	out := in.DeepCopy()
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("DeepCopy() = %+v, want %+v", out, in)
+	}
+
+	out.Labels["app"] = "changed"
+	out.Spec.TargetIngress.JWTServices[0] = "changed"
+	out.Spec.TargetService.Name = "changed"
+	out.Spec.OpenAPISpecFrom[0].ConfigMap.Name = "changed"
+	out.Spec.GRPC.DescriptorSetSecret.Name = "changed"
+	out.Spec.Rollout.Steps[0].Percent = 50
+	out.Spec.Authentication.Providers[0].Audiences[0] = "changed"
+	out.Spec.APIKeys.Paths[0] = "changed"
+	out.Spec.Quota.Costs[0].Methods[0] = "changed"
+	out.Spec.Wildcard.Methods[0] = "changed"
+	out.Status.JWTAudiences[0] = "changed"
+	out.Status.NextRetryTime.Time = time.Time{}
+	out.Status.RolloutPercentages["2018-01-01r0"] = 0
+	out.Status.ConfigHistory[0].Config = "changed"
+	out.Status.Certificate.DomainStatus[testEndpoint] = "ACTIVE"
+	out.Status.StaticIP.CheckTime.Time = time.Time{}
+	out.Status.Conditions[0].Reason = "changed"
+
+	if reflect.DeepEqual(in, out) {
+		t.Fatalf("changing the copy changed the original")
+	}
+	*out = CloudEndpoint{}
+	if copied := in.DeepCopy(); in.Labels["app"] != "svc1" || copied.Spec.TargetIngress.JWTServices[0] != "svc1" || copied.Spec.Rollout.Steps[0].Percent != 10 ||
+		copied.Spec.Authentication.Providers[0].Audiences[0] != "aud" || copied.Status.NextRetryTime.IsZero() || copied.Status.Certificate.DomainStatus[testEndpoint] != "PROVISIONING" {
+		t.Errorf("original changed through the copy: %+v", in)
+	}
+}
+
+func TestCloudEndpointListDeepCopy(t *testing.T) {
+	var nilList *CloudEndpointList
+	if nilList.DeepCopyObject() != nil {
+		t.Errorf("DeepCopyObject() of a nil list is not nil")
+	}
+	var nilParent *CloudEndpoint
+	if nilParent.DeepCopyObject() != nil {
+		t.Errorf("DeepCopyObject() of a nil CloudEndpoint is not nil")
+	}
+
+	in := &CloudEndpointList{Items: []CloudEndpoint{*newTestParent()}}
+	out := in.DeepCopyObject().(*CloudEndpointList)
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("DeepCopyObject() = %+v, want %+v", out, in)
+	}
+	out.Items[0].Spec.Project = "changed"
+	if in.Items[0].Spec.Project == "changed" {
+		t.Errorf("changing the copied list changed the original")
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	gosync "sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// eventDedupInterval is the time an identical event is suppressed for, so that the resync period does not spam the API server.
+const eventDedupInterval = 10 * time.Minute
+
+// recentEvents holds the last time each event was recorded, keyed by object UID, type, reason and message.
+var recentEvents = struct {
+	gosync.Mutex
+	times map[string]time.Time
+}{times: make(map[string]time.Time)}
+
+func newEventRecorder(clientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(rootLogger.Debugf)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+	return broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: "cloud-endpoints-controller"})
+}
+
+// recordEvent records an Event on the CloudEndpoint unless the same event was recorded within the eventDedupInterval.
+func recordEvent(parent *CloudEndpoint, eventType, reason, messageFmt string, args ...interface{}) {
+	if config.recorder == nil {
+		return
+	}
+	message := fmt.Sprintf(messageFmt, args...)
+	key := fmt.Sprintf("%s/%s/%s/%s", parent.UID, eventType, reason, message)
+
+	now := time.Now()
+	recentEvents.Lock()
+	if last, ok := recentEvents.times[key]; ok == true && now.Sub(last) < eventDedupInterval {
+		recentEvents.Unlock()
+		return
+	}
+	for k, t := range recentEvents.times {
+		if now.Sub(t) >= eventDedupInterval {
+			delete(recentEvents.times, k)
+		}
+	}
+	recentEvents.times[key] = now
+	recentEvents.Unlock()
+
+	config.recorder.Event(objectReference(parent), eventType, reason, message)
+}
+
+// objectReference returns a reference to the CloudEndpoint, the custom resource is not registered with the client-go scheme.
+func objectReference(parent *CloudEndpoint) *corev1.ObjectReference {
+	apiVersion, kind := parent.APIVersion, parent.Kind
+	if apiVersion == "" {
+		apiVersion = "ctl.isla.solutions/v1"
+	}
+	if kind == "" {
+		kind = "CloudEndpoint"
+	}
+	return &corev1.ObjectReference{
+		APIVersion:      apiVersion,
+		Kind:            kind,
+		Namespace:       parent.Namespace,
+		Name:            parent.Name,
+		UID:             parent.UID,
+		ResourceVersion: parent.ResourceVersion,
+	}
+}
+
+// recordSyncEvents records a Normal event when the state changed and a Warning event when the sync returned an error.
+func recordSyncEvents(parent *CloudEndpoint, status *CloudEndpointControllerStatus, err error) {
+	prevState := parent.Status.StateCurrent
+	if prevState == "" {
+		prevState = StateIdle
+	}
+	if status.StateCurrent != prevState {
+		recordEvent(parent, corev1.EventTypeNormal, "StateChanged", "State changed from %s to %s", prevState, status.StateCurrent)
+	}
+	if err != nil {
+		reason := status.lastReason
+		if reason == "" {
+			reason = "SyncFailed"
+		}
+		recordEvent(parent, corev1.EventTypeWarning, reason, "%s", err.Error())
+	}
+}
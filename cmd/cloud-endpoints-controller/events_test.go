@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// recordedEvents returns the events recorded by the fake recorder so far.
+func recordedEvents(recorder *record.FakeRecorder) []string {
+	events := make([]string, 0)
+	for {
+		select {
+		case e := <-recorder.Events:
+			events = append(events, e)
+		default:
+			return events
+		}
+	}
+}
+
+func TestRecordEvent(t *testing.T) {
+	newTestEnv(nil, nil)
+	recorder := record.NewFakeRecorder(10)
+	config.recorder = recorder
+	parent := newTestParent()
+	parent.UID = "uid-events"
+
+	recordEvent(parent, corev1.EventTypeNormal, "ConfigSubmitted", "Submitted service config %s", "2018-01-01r0")
+	recordEvent(parent, corev1.EventTypeNormal, "ConfigSubmitted", "Submitted service config %s", "2018-01-01r0")
+	recordEvent(parent, corev1.EventTypeNormal, "ConfigSubmitted", "Submitted service config %s", "2018-01-01r1")
+
+	want := []string{
+		"Normal ConfigSubmitted Submitted service config 2018-01-01r0",
+		"Normal ConfigSubmitted Submitted service config 2018-01-01r1",
+	}
+	if events := recordedEvents(recorder); fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
+
+func TestRecordSyncEvents(t *testing.T) {
+	newTestEnv(nil, nil)
+	recorder := record.NewFakeRecorder(10)
+	config.recorder = recorder
+	parent := newTestParent()
+	parent.UID = "uid-sync-events"
+	parent.Status.StateCurrent = StateEndpointSubmitPending
+
+	status := &CloudEndpointControllerStatus{StateCurrent: StateBackoff, lastReason: "SubmitFailed"}
+	recordSyncEvents(parent, status, fmt.Errorf("bad config"))
+
+	want := []string{
+		"Normal StateChanged State changed from ENDPOINT_SUBMIT_PENDING to BACKOFF",
+		"Warning SubmitFailed bad config",
+	}
+	if events := recordedEvents(recorder); fmt.Sprint(events) != fmt.Sprint(want) {
+		t.Errorf("events = %q, want %q", events, want)
+	}
+}
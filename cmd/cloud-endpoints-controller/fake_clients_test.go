@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	gosync "sync"
+
+	computebeta "google.golang.org/api/compute/v0.beta"
+	compute "google.golang.org/api/compute/v1"
+	"google.golang.org/api/googleapi"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+)
+
+// fakeServiceManager is an in-memory ServiceManager for driving sync() without the Service Management API.
+// Long running operations complete after opSteps calls to GetOperation, their side effects are applied on completion.
+// Service create and undelete are applied immediately because the controller polls GetService instead of the operation.
+type fakeServiceManager struct {
+	mu gosync.Mutex
+
+	opSteps    int
+	opCount    int
+	services   map[string]*servicemanagement.ManagedService
+	deleted    map[string]*servicemanagement.ManagedService
+	configs    map[string][]*servicemanagement.Service
+	rollouts   map[string][]*servicemanagement.Rollout
+	operations map[string]*fakeOperation
+	// submitted lists the config sources of every SubmitConfig call that was not validate only.
+	submitted []*servicemanagement.ConfigSource
+
+	// errors is returned by the next call of the method with the given name, for example "SubmitConfig".
+	errors map[string]error
+	// opErrors is set on the operation started by the method with the given name when it completes.
+	opErrors map[string]*servicemanagement.Status
+}
+
+type fakeOperation struct {
+	op        *servicemanagement.Operation
+	method    string
+	remaining int
+	complete  func()
+}
+
+var _ ServiceManager = &fakeServiceManager{}
+
+func newFakeServiceManager(opSteps int) *fakeServiceManager {
+	return &fakeServiceManager{
+		opSteps:    opSteps,
+		services:   make(map[string]*servicemanagement.ManagedService),
+		deleted:    make(map[string]*servicemanagement.ManagedService),
+		configs:    make(map[string][]*servicemanagement.Service),
+		rollouts:   make(map[string][]*servicemanagement.Rollout),
+		operations: make(map[string]*fakeOperation),
+		errors:     make(map[string]error),
+		opErrors:   make(map[string]*servicemanagement.Status),
+	}
+}
+
+// takeError returns and clears the error injected for the method.
+func (f *fakeServiceManager) takeError(method string) error {
+	err := f.errors[method]
+	delete(f.errors, method)
+	return err
+}
+
+// startOperation records a new operation that runs complete after opSteps polls.
+func (f *fakeServiceManager) startOperation(method string, response interface{}, complete func()) *servicemanagement.Operation {
+	f.opCount++
+	op := &servicemanagement.Operation{
+		Name: fmt.Sprintf("operations/fake.%s.%d", method, f.opCount),
+	}
+	if response != nil {
+		data, _ := json.Marshal(response)
+		op.Response = googleapi.RawMessage(data)
+	}
+	f.operations[op.Name] = &fakeOperation{
+		op:        op,
+		method:    method,
+		remaining: f.opSteps,
+		complete:  complete,
+	}
+	return op
+}
+
+// completedOperation records an operation that is already done.
+func (f *fakeServiceManager) completedOperation(method string, response interface{}) *servicemanagement.Operation {
+	op := f.startOperation(method, response, nil)
+	op.Done = true
+	return op
+}
+
+func (f *fakeServiceManager) notFound(serviceName string) error {
+	return &googleapi.Error{
+		Code:    http.StatusForbidden,
+		Message: fmt.Sprintf("The service '%s' was not found or permission denied.", serviceName),
+	}
+}
+
+func (f *fakeServiceManager) GetService(ctx context.Context, serviceName string) (*servicemanagement.ManagedService, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("GetService"); err != nil {
+		return nil, err
+	}
+	svc, ok := f.services[serviceName]
+	if ok == false {
+		return nil, f.notFound(serviceName)
+	}
+	return svc, nil
+}
+
+func (f *fakeServiceManager) CreateService(ctx context.Context, service *servicemanagement.ManagedService) (*servicemanagement.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("CreateService"); err != nil {
+		return nil, err
+	}
+	name := service.ServiceName
+	if _, ok := f.deleted[name]; ok {
+		return nil, &googleapi.Error{
+			Code:    http.StatusConflict,
+			Message: fmt.Sprintf("Service %s has been deleted and will be purged after 30 days. To reuse this service, please undelete the service.", name),
+		}
+	}
+	if _, ok := f.services[name]; ok {
+		return nil, &googleapi.Error{Code: http.StatusConflict, Message: fmt.Sprintf("Service %s already exists.", name)}
+	}
+	f.services[name] = service
+	return f.completedOperation("CreateService", service), nil
+}
+
+func (f *fakeServiceManager) DeleteService(ctx context.Context, serviceName string) (*servicemanagement.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("DeleteService"); err != nil {
+		return nil, err
+	}
+	svc, ok := f.services[serviceName]
+	if ok == false {
+		return nil, f.notFound(serviceName)
+	}
+	return f.startOperation("DeleteService", nil, func() {
+		delete(f.services, serviceName)
+		f.deleted[serviceName] = svc
+	}), nil
+}
+
+func (f *fakeServiceManager) UndeleteService(ctx context.Context, serviceName string) (*servicemanagement.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("UndeleteService"); err != nil {
+		return nil, err
+	}
+	svc, ok := f.deleted[serviceName]
+	if ok == false {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("Service %s was not deleted.", serviceName)}
+	}
+	delete(f.deleted, serviceName)
+	f.services[serviceName] = svc
+	return f.completedOperation("UndeleteService", nil), nil
+}
+
+func (f *fakeServiceManager) GetConfig(ctx context.Context, serviceName, configID string) (*servicemanagement.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("GetConfig"); err != nil {
+		return nil, err
+	}
+	for _, cfg := range f.configs[serviceName] {
+		if cfg.Id == configID {
+			return cfg, nil
+		}
+	}
+	return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("Service config %s not found for service %s.", configID, serviceName)}
+}
+
+func (f *fakeServiceManager) ListConfigs(ctx context.Context, serviceName string) ([]*servicemanagement.Service, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("ListConfigs"); err != nil {
+		return nil, err
+	}
+	return f.configs[serviceName], nil
+}
+
+func (f *fakeServiceManager) SubmitConfig(ctx context.Context, serviceName string, req *servicemanagement.SubmitConfigSourceRequest) (*servicemanagement.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("SubmitConfig"); err != nil {
+		return nil, err
+	}
+	if _, ok := f.services[serviceName]; ok == false {
+		return nil, f.notFound(serviceName)
+	}
+	if req.ValidateOnly {
+		return f.startOperation("ValidateConfig", nil, nil), nil
+	}
+	f.submitted = append(f.submitted, req.ConfigSource)
+	cfg := &servicemanagement.Service{
+		Id:   fmt.Sprintf("2018-01-01r%d", len(f.configs[serviceName])),
+		Name: serviceName,
+	}
+	resp := servicemanagement.SubmitConfigSourceResponse{ServiceConfig: cfg}
+	return f.startOperation("SubmitConfig", resp, func() {
+		f.configs[serviceName] = append(f.configs[serviceName], cfg)
+	}), nil
+}
+
+func (f *fakeServiceManager) ListRollouts(ctx context.Context, serviceName string) ([]*servicemanagement.Rollout, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("ListRollouts"); err != nil {
+		return nil, err
+	}
+	return f.rollouts[serviceName], nil
+}
+
+func (f *fakeServiceManager) CreateRollout(ctx context.Context, serviceName string, rollout *servicemanagement.Rollout) (*servicemanagement.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("CreateRollout"); err != nil {
+		return nil, err
+	}
+	if rollout.TrafficPercentStrategy != nil {
+		for id := range rollout.TrafficPercentStrategy.Percentages {
+			found := false
+			for _, cfg := range f.configs[serviceName] {
+				found = found || cfg.Id == id
+			}
+			if found == false {
+				return nil, &googleapi.Error{Code: http.StatusBadRequest, Message: fmt.Sprintf("Service config %s not found.", id)}
+			}
+		}
+	}
+	r := *rollout
+	r.RolloutId = fmt.Sprintf("2018-01-01r%d", len(f.rollouts[serviceName]))
+	r.ServiceName = serviceName
+	r.Status = "IN_PROGRESS"
+	// Most recent rollout first, like the API.
+	f.rollouts[serviceName] = append([]*servicemanagement.Rollout{&r}, f.rollouts[serviceName]...)
+	return f.startOperation("CreateRollout", &r, func() {
+		r.Status = "SUCCESS"
+	}), nil
+}
+
+func (f *fakeServiceManager) GetOperation(ctx context.Context, name string) (*servicemanagement.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.takeError("GetOperation"); err != nil {
+		return nil, err
+	}
+	o, ok := f.operations[name]
+	if ok == false {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("Operation %s not found.", name)}
+	}
+	if o.op.Done {
+		return o.op, nil
+	}
+	if o.remaining > 0 {
+		o.remaining--
+	}
+	if o.remaining == 0 {
+		o.op.Done = true
+		if opErr, ok := f.opErrors[o.method]; ok {
+			o.op.Error = opErr
+			o.op.Response = nil
+			delete(f.opErrors, o.method)
+		} else if o.complete != nil {
+			o.complete()
+		}
+	}
+	return o.op, nil
+}
+
+// fakeCompute is an in-memory ComputeClient. Managed certificates are created in the PROVISIONING state,
+// global addresses are reserved immediately with addresses from 203.0.113.0/24.
+type fakeCompute struct {
+	mu gosync.Mutex
+
+	backendServices map[string]*compute.BackendService
+	sslCertificates map[string]*computebeta.SslCertificate
+	globalAddresses map[string]*compute.Address
+}
+
+var _ ComputeClient = &fakeCompute{}
+
+func newFakeCompute() *fakeCompute {
+	return &fakeCompute{
+		backendServices: make(map[string]*compute.BackendService),
+		sslCertificates: make(map[string]*computebeta.SslCertificate),
+		globalAddresses: make(map[string]*compute.Address),
+	}
+}
+
+func (f *fakeCompute) GetBackendService(ctx context.Context, project, name string) (*compute.BackendService, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	be, ok := f.backendServices[name]
+	if ok == false {
+		return nil, &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("The resource 'projects/%s/global/backendServices/%s' was not found", project, name)}
+	}
+	return be, nil
+}
+
+func (f *fakeCompute) certNotFound(project, name string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("The resource 'projects/%s/global/sslCertificates/%s' was not found", project, name)}
+}
+
+func (f *fakeCompute) GetSslCertificate(ctx context.Context, project, name string) (*computebeta.SslCertificate, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cert, ok := f.sslCertificates[name]
+	if ok == false {
+		return nil, f.certNotFound(project, name)
+	}
+	return cert, nil
+}
+
+func (f *fakeCompute) InsertSslCertificate(ctx context.Context, project string, cert *computebeta.SslCertificate) (*computebeta.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.sslCertificates[cert.Name]; ok {
+		return nil, &googleapi.Error{Code: http.StatusConflict, Message: fmt.Sprintf("The resource 'projects/%s/global/sslCertificates/%s' already exists", project, cert.Name)}
+	}
+	c := *cert
+	if c.Managed != nil {
+		managed := *c.Managed
+		managed.Status = "PROVISIONING"
+		managed.DomainStatus = make(map[string]string)
+		for _, d := range managed.Domains {
+			managed.DomainStatus[d] = "PROVISIONING"
+		}
+		c.Managed = &managed
+	}
+	f.sslCertificates[cert.Name] = &c
+	return &computebeta.Operation{Name: fmt.Sprintf("operation-insert-%s", cert.Name), Status: "DONE"}, nil
+}
+
+func (f *fakeCompute) DeleteSslCertificate(ctx context.Context, project, name string) (*computebeta.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.sslCertificates[name]; ok == false {
+		return nil, f.certNotFound(project, name)
+	}
+	delete(f.sslCertificates, name)
+	return &computebeta.Operation{Name: fmt.Sprintf("operation-delete-%s", name), Status: "DONE"}, nil
+}
+
+func (f *fakeCompute) addressNotFound(project, name string) error {
+	return &googleapi.Error{Code: http.StatusNotFound, Message: fmt.Sprintf("The resource 'projects/%s/global/addresses/%s' was not found", project, name)}
+}
+
+func (f *fakeCompute) GetGlobalAddress(ctx context.Context, project, name string) (*compute.Address, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	addr, ok := f.globalAddresses[name]
+	if ok == false {
+		return nil, f.addressNotFound(project, name)
+	}
+	return addr, nil
+}
+
+func (f *fakeCompute) InsertGlobalAddress(ctx context.Context, project string, address *compute.Address) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.globalAddresses[address.Name]; ok {
+		return nil, &googleapi.Error{Code: http.StatusConflict, Message: fmt.Sprintf("The resource 'projects/%s/global/addresses/%s' already exists", project, address.Name)}
+	}
+	a := *address
+	a.Address = fmt.Sprintf("203.0.113.%d", len(f.globalAddresses)+1)
+	a.Status = "RESERVED"
+	f.globalAddresses[address.Name] = &a
+	return &compute.Operation{Name: fmt.Sprintf("operation-insert-%s", address.Name), Status: "DONE"}, nil
+}
+
+func (f *fakeCompute) DeleteGlobalAddress(ctx context.Context, project, name string) (*compute.Operation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.globalAddresses[name]; ok == false {
+		return nil, f.addressNotFound(project, name)
+	}
+	delete(f.globalAddresses, name)
+	return &compute.Operation{Name: fmt.Sprintf("operation-delete-%s", name), Status: "DONE"}, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func finalize(ctx context.Context, parent *CloudEndpoint, children *CloudEndpointControllerRequestChildren) (_ *CloudEndpointControllerStatus, _ *[]interface{}, finalized bool, err error) {
+	start := time.Now()
+	logger := loggerFrom(ctx)
+	status := makeStatus(parent, children)
+	desiredChildren := make([]interface{}, 0)
+	defer func() {
+		recordSyncEvents(parent, status, err)
+		observeSync("finalize", start, parent, status, err)
+		if finalized {
+			forgetEndpoint(parent)
+		}
+	}()
+
+	ep := status.Endpoint
+	if ep == "" {
+		ep = fmt.Sprintf("%s.endpoints.%s.cloud.goog", parent.Name, parent.Spec.Project)
+		logger = logger.WithField("endpoint", ep)
+		ctx = withLogger(ctx, logger)
+	}
+
+	switch parent.Spec.DeletionPolicy {
+	case DeletionPolicyAbandon:
+		logger.WithField("deletionPolicy", DeletionPolicyAbandon).Info("Leaving endpoint service")
+		return status, &desiredChildren, true, nil
+
+	case "", DeletionPolicyRetain:
+		// Let any in-flight submit or rollout finish so the service is not left half configured.
+		for _, opName := range []string{status.ConfigSubmit, status.ServiceRollout} {
+			if opName == "" || opName == "NA" {
+				continue
+			}
+			op, err := config.clientServiceMan.GetOperation(ctx, opName)
+			if err != nil {
+				return status, &desiredChildren, false, fmt.Errorf("Failed to get operation: %s, %v", opName, err)
+			}
+			if op.Done == false {
+				logger.WithField("operation", opName).Info("Waiting for operation to complete before finalizing")
+				return status, &desiredChildren, false, nil
+			}
+		}
+		logger.WithField("deletionPolicy", DeletionPolicyRetain).Info("Leaving endpoint service")
+		return status, &desiredChildren, true, nil
+
+	case DeletionPolicyDelete:
+		if status.Certificate != nil {
+			if err := releaseManagedCertificate(ctx, parent, status); err != nil {
+				logger.WithError(err).Info("Waiting for managed certificate delete")
+				return status, &desiredChildren, false, err
+			}
+		}
+		if status.StaticIP != nil {
+			if err := releaseStaticIP(ctx, parent, status); err != nil {
+				logger.WithError(err).Info("Waiting for static IP delete")
+				return status, &desiredChildren, false, err
+			}
+		}
+
+	default:
+		return status, &desiredChildren, false, fmt.Errorf("Invalid deletionPolicy: '%s', must be one of: %s, %s, %s", parent.Spec.DeletionPolicy, DeletionPolicyDelete, DeletionPolicyRetain, DeletionPolicyAbandon)
+	}
+
+	if status.ServiceDelete == "" {
+		_, err := config.clientServiceMan.GetService(ctx, ep)
+		if err != nil {
+			if serviceNotFound(err) {
+				logger.Info("Endpoint service not found, nothing to delete")
+				return status, &desiredChildren, true, nil
+			}
+			return status, &desiredChildren, false, fmt.Errorf("Failed to get existing endpoint service: %s, %v", ep, err)
+		}
+
+		logger.Info("Deleting endpoint service")
+		op, err := config.clientServiceMan.DeleteService(ctx, ep)
+		if err != nil {
+			return status, &desiredChildren, false, fmt.Errorf("Failed to delete endpoint service: %s, %v", ep, err)
+		}
+		status.ServiceDelete = op.Name
+		status.StateCurrent = StateEndpointDeletePending
+		recordEvent(parent, corev1.EventTypeNormal, "ServiceDeleting", "Deleting Cloud Endpoints service %s", ep)
+		return status, &desiredChildren, false, nil
+	}
+
+	op, err := config.clientServiceMan.GetOperation(ctx, status.ServiceDelete)
+	if err != nil {
+		return status, &desiredChildren, false, fmt.Errorf("Failed to get service delete operation id: %s", status.ServiceDelete)
+	}
+	if op.Done == false {
+		logger.WithField("operation", status.ServiceDelete).Info("Waiting for endpoint service delete")
+		return status, &desiredChildren, false, nil
+	}
+	if op.Error != nil {
+		// Clear the operation so the delete is retried on the next finalize call.
+		status.ServiceDelete = ""
+		return status, &desiredChildren, false, fmt.Errorf("Failed to delete endpoint service: %s, %s", ep, op.Error.Message)
+	}
+
+	logger.Info("Endpoint service deleted")
+	return status, &desiredChildren, true, nil
+}
+
+// serviceNotFound returns true if the Service Management API reported the service as missing.
+func serviceNotFound(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && gerr.Code == http.StatusNotFound
+}
+
+// serviceNotVisible returns true if the service is missing or the caller is not allowed to see it.
+// The API returns 403 for services that do not exist, a create then fails if the permission is really missing.
+func serviceNotVisible(err error) bool {
+	gerr, ok := err.(*googleapi.Error)
+	return ok && (gerr.Code == http.StatusNotFound || gerr.Code == http.StatusForbidden)
+}
+
+// serviceSoftDeleted returns true if a create failed because the service was deleted within the last 30 days.
+// The API returns 409 for this and for services that already exist, so only the message tells them apart.
+func serviceSoftDeleted(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "undelete") || strings.Contains(msg, "has been deleted")
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/api/googleapi"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+)
+
+// runFinalizes calls finalize n times, feeding the returned status back into the parent like metacontroller does.
+// Only the last call may return an error.
+func runFinalizes(t *testing.T, parent *CloudEndpoint, n int) (*CloudEndpointControllerStatus, bool, error) {
+	var status *CloudEndpointControllerStatus
+	var finalized bool
+	var err error
+	for i := 0; i < n; i++ {
+		if err != nil {
+			t.Fatalf("finalize %d returned error: %v", i, err)
+		}
+		status, _, finalized, err = finalize(context.Background(), parent, &CloudEndpointControllerRequestChildren{})
+		parent.Status = *status
+	}
+	return status, finalized, err
+}
+
+// finalizeTest is a finalize transition case for an idle parent with the given deletion policy.
+type finalizeTest struct {
+	name      string
+	policy    CloudEndpointDeletionPolicy
+	setup     func(env *testEnv, parent *CloudEndpoint)
+	calls     int
+	wantErr   bool
+	finalized bool
+	state     string
+	check     func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus)
+}
+
+// runFinalizeTests runs every case against a new test environment and parent.
+func runFinalizeTests(t *testing.T, tests []finalizeTest) {
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(nil, nil)
+			parent := newTestParent()
+			parent.Spec.DeletionPolicy = tc.policy
+			parent.Status = CloudEndpointControllerStatus{StateCurrent: StateIdle, Endpoint: testEndpoint}
+			if tc.setup != nil {
+				tc.setup(env, parent)
+			}
+
+			status, finalized, err := runFinalizes(t, parent, tc.calls)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("finalize error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if finalized != tc.finalized {
+				t.Errorf("finalized = %v, want %v", finalized, tc.finalized)
+			}
+			if tc.state != "" && status.StateCurrent != tc.state {
+				t.Errorf("state = %s, want %s", status.StateCurrent, tc.state)
+			}
+			if tc.check != nil {
+				tc.check(t, env, status)
+			}
+		})
+	}
+}
+
+func TestFinalize(t *testing.T) {
+	runFinalizeTests(t, []finalizeTest{
+		{
+			name:   "delete starts the service delete",
+			policy: DeletionPolicyDelete,
+			setup:  func(env *testEnv, parent *CloudEndpoint) { seedService(env) },
+			calls:  1,
+			state:  StateEndpointDeletePending,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.ServiceDelete == "" {
+					t.Errorf("serviceDelete operation not set")
+				}
+			},
+		},
+		{
+			name:      "delete finalizes once the service is deleted",
+			policy:    DeletionPolicyDelete,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env) },
+			calls:     2,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok {
+					t.Errorf("service %s not deleted", testEndpoint)
+				}
+			},
+		},
+		{
+			name:   "failed delete operation is retried",
+			policy: DeletionPolicyDelete,
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				seedService(env)
+				env.sm.opErrors["DeleteService"] = &servicemanagement.Status{Message: "delete failed"}
+			},
+			calls:   2,
+			wantErr: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.ServiceDelete != "" {
+					t.Errorf("serviceDelete = %s, want cleared", status.ServiceDelete)
+				}
+				if _, ok := env.sm.services[testEndpoint]; ok == false {
+					t.Errorf("service %s deleted", testEndpoint)
+				}
+			},
+		},
+	})
+}
+
+func TestFinalizeDeletionPolicy(t *testing.T) {
+	runFinalizeTests(t, []finalizeTest{
+		{
+			name:      "default policy keeps the service",
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env) },
+			calls:     1,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok == false {
+					t.Errorf("service %s deleted", testEndpoint)
+				}
+			},
+		},
+		{
+			name:   "missing service is finalized",
+			policy: DeletionPolicyDelete,
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["GetService"] = &googleapi.Error{Code: http.StatusNotFound, Message: "service not found"}
+			},
+			calls:     1,
+			finalized: true,
+		},
+		{
+			name:    "permission denied keeps the finalizer",
+			policy:  DeletionPolicyDelete,
+			calls:   1,
+			wantErr: true,
+		},
+		{
+			name:   "service lookup error is retried",
+			policy: DeletionPolicyDelete,
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["GetService"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			calls:   1,
+			wantErr: true,
+		},
+		{
+			name:   "retain waits for an in-flight rollout",
+			policy: DeletionPolicyRetain,
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				seedService(env)
+				env.sm.opSteps = 2
+				parent.Status.ServiceRollout = env.sm.startOperation("CreateRollout", nil, nil).Name
+			},
+			calls: 1,
+		},
+		{
+			name:      "retain keeps the service",
+			policy:    DeletionPolicyRetain,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env); seedStaticIP(env, parent, true) },
+			calls:     1,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok == false {
+					t.Errorf("service %s deleted", testEndpoint)
+				}
+				if _, ok := env.compute.globalAddresses[testComputeName]; ok == false {
+					t.Errorf("static IP %s deleted", testComputeName)
+				}
+			},
+		},
+		{
+			name:      "abandon keeps the service",
+			policy:    DeletionPolicyAbandon,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env) },
+			calls:     1,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok == false {
+					t.Errorf("service %s deleted", testEndpoint)
+				}
+			},
+		},
+		{
+			name:    "invalid deletion policy",
+			policy:  "Orphan",
+			setup:   func(env *testEnv, parent *CloudEndpoint) { seedService(env) },
+			calls:   1,
+			wantErr: true,
+		},
+	})
+}
+
+func TestServiceNotFound(t *testing.T) {
+	tests := []struct {
+		err        error
+		notFound   bool
+		notVisible bool
+	}{
+		{&googleapi.Error{Code: http.StatusNotFound}, true, true},
+		{&googleapi.Error{Code: http.StatusForbidden, Message: "The service 'svc1' was not found or permission denied."}, false, true},
+		{&googleapi.Error{Code: http.StatusInternalServerError}, false, false},
+		{fmt.Errorf("service not found or permission denied"), false, false},
+	}
+	for _, tc := range tests {
+		if got := serviceNotFound(tc.err); got != tc.notFound {
+			t.Errorf("serviceNotFound(%v) = %v, want %v", tc.err, got, tc.notFound)
+		}
+		if got := serviceNotVisible(tc.err); got != tc.notVisible {
+			t.Errorf("serviceNotVisible(%v) = %v, want %v", tc.err, got, tc.notVisible)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+
+	"github.com/ghodss/yaml"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+)
+
+// sourceNotFoundError is returned when a ConfigMap or Secret referenced by the spec could not be loaded yet.
+type sourceNotFoundError struct {
+	msg string
+}
+
+func (e sourceNotFoundError) Error() string {
+	return e.msg
+}
+
+// hasExternalSources returns true if any of the gRPC sources are read from a ConfigMap or Secret.
+func (s *CloudEndpointGRPCSpec) hasExternalSources() bool {
+	return s.DescriptorSetConfigMap != nil || s.DescriptorSetSecret != nil || s.ServiceConfigConfigMap != nil
+}
+
+// getGRPCSources returns the decoded proto descriptor set and the gRPC service config template.
+func getGRPCSources(namespace string, spec *CloudEndpointGRPCSpec) ([]byte, string, error) {
+	var descriptorSet []byte
+	var err error
+
+	switch {
+	case spec.DescriptorSet != "":
+		descriptorSet, err = base64.StdEncoding.DecodeString(spec.DescriptorSet)
+		if err != nil {
+			return nil, "", fmt.Errorf("Failed to decode grpc.descriptorSet, must be a base64 encoded FileDescriptorSet: %v", err)
+		}
+	case spec.DescriptorSetConfigMap != nil:
+		name, key := spec.DescriptorSetConfigMap.Name, spec.DescriptorSetConfigMap.Key
+		descriptorSet, err = getConfigMapBinaryData(namespace, name, key)
+		if err != nil || len(descriptorSet) == 0 {
+			return nil, "", sourceNotFoundError{fmt.Sprintf("Waiting for ConfigMap with descriptor set named '%s' containing binaryData key: '%s'", name, key)}
+		}
+	case spec.DescriptorSetSecret != nil:
+		name, key := spec.DescriptorSetSecret.Name, spec.DescriptorSetSecret.Key
+		descriptorSet, err = getSecretData(namespace, name, key)
+		if err != nil || len(descriptorSet) == 0 {
+			return nil, "", sourceNotFoundError{fmt.Sprintf("Waiting for Secret with descriptor set named '%s' containing key: '%s'", name, key)}
+		}
+	default:
+		return nil, "", fmt.Errorf("One of grpc.descriptorSet, grpc.descriptorSetConfigMap or grpc.descriptorSetSecret is required")
+	}
+
+	serviceConfig := spec.ServiceConfig
+	if serviceConfig == "" {
+		if spec.ServiceConfigConfigMap == nil {
+			return nil, "", fmt.Errorf("One of grpc.serviceConfig or grpc.serviceConfigConfigMap is required")
+		}
+		name, key := spec.ServiceConfigConfigMap.Name, spec.ServiceConfigConfigMap.Key
+		serviceConfig, err = getConfigMapSpecData(namespace, name, key)
+		if err != nil || serviceConfig == "" {
+			return nil, "", sourceNotFoundError{fmt.Sprintf("Waiting for ConfigMap with service config named '%s' containing key: '%s'", name, key)}
+		}
+	}
+
+	return descriptorSet, serviceConfig, nil
+}
+
+// grpcSourceHash returns the hash of the gRPC sources used for change detection.
+func grpcSourceHash(descriptorSet []byte, serviceConfigTemplate string) string {
+	return toSha1(base64.StdEncoding.EncodeToString(descriptorSet) + serviceConfigTemplate)
+}
+
+func validateGRPCServiceConfig(serviceConfig string) error {
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal([]byte(serviceConfig), &spec); err != nil {
+		return err
+	}
+	if t, _ := spec["type"].(string); t != "google.api.Service" {
+		return fmt.Errorf("gRPC service config must have 'type: google.api.Service', found: '%v'", spec["type"])
+	}
+	return nil
+}
+
+func makeGRPCConfigFiles(descriptorSet []byte, serviceConfig string) []*servicemanagement.ConfigFile {
+	return []*servicemanagement.ConfigFile{
+		&servicemanagement.ConfigFile{
+			FileContents: base64.StdEncoding.EncodeToString(descriptorSet),
+			FilePath:     "api_descriptor.pb",
+			FileType:     "FILE_DESCRIPTOR_SET_PROTO",
+		},
+		&servicemanagement.ConfigFile{
+			FileContents: base64.StdEncoding.EncodeToString([]byte(serviceConfig)),
+			FilePath:     "api_config.yaml",
+			FileType:     "SERVICE_CONFIG_YAML",
+		},
+	}
+}
+
+func getConfigMapBinaryData(namespace string, name string, key string) ([]byte, error) {
+	configMap, err := getConfigMap(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return configMap.BinaryData[key], nil
+}
+
+func getSecretData(namespace string, name string, key string) ([]byte, error) {
+	secret, err := getSecret(namespace, name)
+	if err != nil {
+		return nil, err
+	}
+	return secret.Data[key], nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const testGRPCServiceConfig = `type: google.api.Service
+config_version: 3
+name: "{{ .Endpoint }}"
+`
+
+func TestSyncGRPC(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "gRPC endpoint submits the descriptor set and service config",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.GRPC = &CloudEndpointGRPCSpec{DescriptorSet: "Cg==", ServiceConfig: testGRPCServiceConfig}
+			},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				files := submittedFiles(t, env, 0)
+				if len(files) != 2 || files[0] != "\n" || strings.Contains(files[1], testEndpoint) == false {
+					t.Errorf("submitted files = %q", files)
+				}
+			},
+		},
+		{
+			name: "descriptor set from a ConfigMap",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.GRPC = &CloudEndpointGRPCSpec{
+					DescriptorSetConfigMap: &CloudEndpointConfigMapSpec{Name: "protos", Key: "api.pb"},
+					ServiceConfig:          testGRPCServiceConfig,
+				}
+			},
+			objects: []runtime.Object{&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "protos", Namespace: "default"}, BinaryData: map[string][]byte{"api.pb": []byte("\n")}}},
+			syncs:   4,
+			state:   StateIdle,
+		},
+		{
+			name: "missing descriptor set ConfigMap waits",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.GRPC = &CloudEndpointGRPCSpec{
+					DescriptorSetConfigMap: &CloudEndpointConfigMapSpec{Name: "protos", Key: "api.pb"},
+					ServiceConfig:          testGRPCServiceConfig,
+				}
+			},
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "WaitingForGRPCSource"},
+		},
+		{
+			name: "service config that is not a google.api.Service backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.GRPC = &CloudEndpointGRPCSpec{DescriptorSet: "Cg==", ServiceConfig: "type: other"}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "InvalidSpec"},
+		},
+		{
+			name: "descriptor set that is not base64 backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.GRPC = &CloudEndpointGRPCSpec{DescriptorSet: "not base64", ServiceConfig: testGRPCServiceConfig}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "InvalidSpec"},
+		},
+	})
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	gosync "sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	//TargetKindIngress resolves the target from the load balancer status of an Ingress
+	TargetKindIngress = "Ingress"
+	//TargetKindGateway resolves the target from the status addresses of a Gateway API Gateway
+	TargetKindGateway = "Gateway"
+
+	// Time the result of an API discovery lookup is cached.
+	discoveryCacheTTL = 5 * time.Minute
+)
+
+var (
+	ingressV1GVR      = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+	ingressV1beta1GVR = schema.GroupVersionResource{Group: "extensions", Version: "v1beta1", Resource: "ingresses"}
+	gatewayV1GVR      = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1", Resource: "gateways"}
+	gatewayV1beta1GVR = schema.GroupVersionResource{Group: "gateway.networking.k8s.io", Version: "v1beta1", Resource: "gateways"}
+)
+
+// servedResources caches whether the API server serves a resource, keyed by the GroupVersionResource.
+var servedResources = struct {
+	gosync.Mutex
+	entries map[schema.GroupVersionResource]servedResourceEntry
+}{entries: make(map[schema.GroupVersionResource]servedResourceEntry)}
+
+type servedResourceEntry struct {
+	served     bool
+	lookupTime time.Time
+}
+
+// resourceServed returns true if the API server serves the resource, using the discovery API.
+func resourceServed(gvr schema.GroupVersionResource) bool {
+	servedResources.Lock()
+	entry, ok := servedResources.entries[gvr]
+	servedResources.Unlock()
+	if ok == true && time.Since(entry.lookupTime) < discoveryCacheTTL {
+		return entry.served
+	}
+
+	served := false
+	resources, err := config.clientset.Discovery().ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err == nil {
+		for _, r := range resources.APIResources {
+			if r.Name == gvr.Resource {
+				served = true
+			}
+		}
+	}
+
+	servedResources.Lock()
+	servedResources.entries[gvr] = servedResourceEntry{served: served, lookupTime: time.Now()}
+	servedResources.Unlock()
+	return served
+}
+
+// targetIngressKind returns the kind of the target ingress, which defaults to Ingress.
+func targetIngressKind(spec CloudEndpointTargetIngressSpec) string {
+	if spec.Kind == "" {
+		return TargetKindIngress
+	}
+	return spec.Kind
+}
+
+// targetIngressGVR returns the resource of the target ingress from its kind and apiVersion.
+// Without an apiVersion the newest version served by the cluster is used, so that clusters older than Kubernetes 1.19 keep using extensions/v1beta1.
+func targetIngressGVR(spec CloudEndpointTargetIngressSpec) (schema.GroupVersionResource, error) {
+	var candidates []schema.GroupVersionResource
+	switch targetIngressKind(spec) {
+	case TargetKindIngress:
+		candidates = []schema.GroupVersionResource{ingressV1GVR, ingressV1beta1GVR}
+	case TargetKindGateway:
+		candidates = []schema.GroupVersionResource{gatewayV1GVR, gatewayV1beta1GVR}
+	default:
+		return schema.GroupVersionResource{}, fmt.Errorf("Invalid targetIngress.kind: '%s', must be one of: %s, %s", spec.Kind, TargetKindIngress, TargetKindGateway)
+	}
+
+	if spec.APIVersion != "" {
+		gv, err := schema.ParseGroupVersion(spec.APIVersion)
+		if err != nil {
+			return schema.GroupVersionResource{}, fmt.Errorf("Invalid targetIngress.apiVersion: '%s', %v", spec.APIVersion, err)
+		}
+		return gv.WithResource(candidates[0].Resource), nil
+	}
+
+	for _, gvr := range candidates {
+		if resourceServed(gvr) {
+			return gvr, nil
+		}
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+// getTargetObject returns the target ingress from the informer cache in standalone mode, or from the API server.
+func getTargetObject(gvr schema.GroupVersionResource, namespace, name string) (*unstructured.Unstructured, error) {
+	if config.listers != nil {
+		if lister, ok := config.listers.targets[gvr]; ok == true {
+			obj, err := lister.ByNamespace(namespace).Get(name)
+			if err != nil {
+				return nil, err
+			}
+			u, ok := obj.(*unstructured.Unstructured)
+			if ok == false {
+				return nil, fmt.Errorf("Unexpected object type: %T", obj)
+			}
+			return u, nil
+		}
+	}
+	return config.dynamicClient.Resource(gvr).Namespace(namespace).Get(name, metav1.GetOptions{})
+}
+
+// targetAddresses returns the IP addresses and hostnames of the target ingress, from status.loadBalancer.ingress for an Ingress and from status.addresses for a Gateway.
+func targetAddresses(kind string, obj *unstructured.Unstructured) []string {
+	addresses := make([]string, 0)
+	switch kind {
+	case TargetKindGateway:
+		items, _, _ := unstructured.NestedSlice(obj.Object, "status", "addresses")
+		for _, item := range items {
+			addr, ok := item.(map[string]interface{})
+			if ok == false {
+				continue
+			}
+			addrType, _, _ := unstructured.NestedString(addr, "type")
+			value, _, _ := unstructured.NestedString(addr, "value")
+			if value != "" && (addrType == "" || addrType == "IPAddress" || addrType == "Hostname") {
+				addresses = append(addresses, value)
+			}
+		}
+	default:
+		items, _, _ := unstructured.NestedSlice(obj.Object, "status", "loadBalancer", "ingress")
+		for _, item := range items {
+			ing, ok := item.(map[string]interface{})
+			if ok == false {
+				continue
+			}
+			if ip, _, _ := unstructured.NestedString(ing, "ip"); ip != "" {
+				addresses = append(addresses, ip)
+			}
+			if hostname, _, _ := unstructured.NestedString(ing, "hostname"); hostname != "" {
+				addresses = append(addresses, hostname)
+			}
+		}
+	}
+	return addresses
+}
+
+// resolveTargetIngress returns the target ingress and its addresses. A missing object returns nil without an error.
+func resolveTargetIngress(spec CloudEndpointTargetIngressSpec) (*unstructured.Unstructured, []string, error) {
+	gvr, err := targetIngressGVR(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := getTargetObject(gvr, spec.Namespace, spec.Name)
+	if err != nil {
+		return nil, nil, nil
+	}
+	return obj, targetAddresses(targetIngressKind(spec), obj), nil
+}
+
+// getIngressAnnotations returns the annotations of the Ingress with the given namespace/name key, read from the API server.
+func getIngressAnnotations(key string) (map[string]string, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, err
+	}
+	gvr, err := targetIngressGVR(CloudEndpointTargetIngressSpec{Kind: TargetKindIngress})
+	if err != nil {
+		return nil, err
+	}
+	ingress, err := config.dynamicClient.Resource(gvr).Namespace(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return ingress.GetAnnotations(), nil
+}
+
+// patchIngressAnnotation sets the annotation of the Ingress with the given namespace/name key with a merge patch, a nil value removes it.
+func patchIngressAnnotation(key, annotation string, value interface{}) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+	gvr, err := targetIngressGVR(CloudEndpointTargetIngressSpec{Kind: TargetKindIngress})
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]interface{}{annotation: value},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = config.dynamicClient.Resource(gvr).Namespace(namespace).Patch(name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
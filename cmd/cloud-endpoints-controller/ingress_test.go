@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSyncTargetIngress(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "networking.k8s.io/v1 Ingress target",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web"}
+			},
+			targets: []runtime.Object{testIngress("default", "web", []string{"203.0.113.40"})},
+			syncs:   4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.IngressIP != "203.0.113.40" {
+					t.Errorf("ingressIP = %s, want 203.0.113.40", status.IngressIP)
+				}
+			},
+		},
+		{
+			name: "Gateway target",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "gw", Kind: TargetKindGateway}
+			},
+			// The fake dynamic client guesses the resource from the kind as "gatewaies", create the Gateway with its resource instead.
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				gw := &unstructured.Unstructured{Object: map[string]interface{}{
+					"apiVersion": "gateway.networking.k8s.io/v1",
+					"kind":       "Gateway",
+					"metadata":   map[string]interface{}{"name": "gw", "namespace": "default"},
+					"status": map[string]interface{}{
+						"addresses": []interface{}{map[string]interface{}{"type": "IPAddress", "value": "203.0.113.41"}},
+					},
+				}}
+				if _, err := config.dynamicClient.Resource(gatewayV1GVR).Namespace("default").Create(gw, metav1.CreateOptions{}); err != nil {
+					panic(err)
+				}
+			},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.IngressIP != "203.0.113.41" {
+					t.Errorf("ingressIP = %s, want 203.0.113.41", status.IngressIP)
+				}
+			},
+		},
+		{
+			name: "missing target Ingress waits",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web"}
+			},
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionTargetResolved: "WaitingForIngress"},
+		},
+		{
+			name: "invalid target kind backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web", Kind: "Route"}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionTargetResolved: "TargetIngressError"},
+		},
+	})
+}
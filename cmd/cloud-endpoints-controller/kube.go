@@ -0,0 +1,45 @@
+package main
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// kubeListers read dependent objects from the shared informer caches in standalone mode.
+// When nil, the objects are fetched from the API server on every call.
+// The objects returned by the listers are shared with the cache and must not be modified.
+// Secrets are always fetched from the API server so that the controller does not cache every Secret in the cluster.
+type kubeListers struct {
+	targets    map[schema.GroupVersionResource]cache.GenericLister
+	services   corelisters.ServiceLister
+	configMaps corelisters.ConfigMapLister
+	namespaces corelisters.NamespaceLister
+}
+
+func getService(namespace, name string) (*corev1.Service, error) {
+	if config.listers != nil {
+		return config.listers.services.Services(namespace).Get(name)
+	}
+	return config.clientset.CoreV1().Services(namespace).Get(name, metav1.GetOptions{})
+}
+
+func getConfigMap(namespace, name string) (*corev1.ConfigMap, error) {
+	if config.listers != nil {
+		return config.listers.configMaps.ConfigMaps(namespace).Get(name)
+	}
+	return config.clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+func getSecret(namespace, name string) (*corev1.Secret, error) {
+	return config.clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+}
+
+func getNamespace(name string) (*corev1.Namespace, error) {
+	if config.listers != nil {
+		return config.listers.namespaces.Get(name)
+	}
+	return config.clientset.CoreV1().Namespaces().Get(name, metav1.GetOptions{})
+}
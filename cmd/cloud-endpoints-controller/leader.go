@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/uuid"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+
+	// Duration of the per endpoint lease taken by a replica in metacontroller mode before it syncs a CloudEndpoint.
+	endpointLeaseDurationSeconds = 30
+)
+
+// leader is 1 while this replica is the active leader. Replicas in metacontroller mode are always active.
+var leader int32
+
+func isLeader() bool {
+	return atomic.LoadInt32(&leader) == 1
+}
+
+func setLeader(active bool) {
+	var v int32
+	if active {
+		v = 1
+	}
+	atomic.StoreInt32(&leader, v)
+	metricLeader.Set(float64(v))
+}
+
+// readyzHandler reports ready only on the active leader. It is not used as the readiness probe, a standby replica must stay ready so rolling updates can progress.
+func readyzHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if isLeader() == false {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "Not leader\n")
+			return
+		}
+		fmt.Fprintf(w, "OK\n")
+	}
+}
+
+// replicaIdentity returns the identity of this replica used as the lease holder.
+func replicaIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "cloud-endpoints-controller"
+	}
+	return hostname + "_" + string(uuid.NewUUID())
+}
+
+// runLeaderElection blocks until this replica acquires the Lease, then calls run. The process exits when the lease is lost.
+func runLeaderElection(identity string, run func(stopCh <-chan struct{})) {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Namespace: config.LeaderElectionNamespace,
+			Name:      config.LeaderElectionID,
+		},
+		Client: config.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: identity,
+		},
+	}
+
+	leaderelection.RunOrDie(context.Background(), leaderelection.LeaderElectionConfig{
+		Lock:          lock,
+		LeaseDuration: leaseDuration,
+		RenewDeadline: renewDeadline,
+		RetryPeriod:   retryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				rootLogger.WithField("identity", identity).Info("Started leading")
+				setLeader(true)
+				run(ctx.Done())
+			},
+			OnStoppedLeading: func() {
+				setLeader(false)
+				rootLogger.WithField("identity", identity).Fatal("Lost leader election lease")
+			},
+			OnNewLeader: func(current string) {
+				if current != identity {
+					rootLogger.WithField("leader", current).Info("New leader elected")
+				}
+			},
+		},
+	})
+}
+
+// endpointLocks serializes sync calls for the same CloudEndpoint within this replica.
+var endpointLocks = struct {
+	gosync.Mutex
+	locks map[string]*gosync.Mutex
+}{locks: make(map[string]*gosync.Mutex)}
+
+// lockEndpoint blocks until no other sync call of this replica holds the CloudEndpoint and returns the unlock function.
+func lockEndpoint(parent *CloudEndpoint) func() {
+	key := endpointKey(parent)
+	endpointLocks.Lock()
+	l, ok := endpointLocks.locks[key]
+	if ok == false {
+		l = &gosync.Mutex{}
+		endpointLocks.locks[key] = l
+	}
+	endpointLocks.Unlock()
+	l.Lock()
+	return l.Unlock
+}
+
+// lockSync serializes sync calls for the CloudEndpoint within this replica and, with leader election enabled, across replicas with a Lease.
+// It returns false if another replica holds the CloudEndpoint, the current status is then returned to metacontroller unchanged.
+func lockSync(logger *logrus.Entry, parent *CloudEndpoint) (func(), bool) {
+	unlock := lockEndpoint(parent)
+	if config.LeaderElect == false {
+		return unlock, true
+	}
+	acquired, err := acquireEndpointLease(config.identity, parent)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to acquire CloudEndpoint lease")
+	}
+	if acquired == false {
+		unlock()
+		logger.Debug("CloudEndpoint lease held by another replica, skipping sync")
+		return nil, false
+	}
+	return unlock, true
+}
+
+// acquireEndpointLease takes or renews a Lease for the CloudEndpoint so that only one replica syncs it.
+// It returns false if another replica holds an unexpired lease. The lease is kept between syncs and renewed at half its duration.
+func acquireEndpointLease(identity string, parent *CloudEndpoint) (bool, error) {
+	leases := config.clientset.CoordinationV1().Leases(parent.Namespace)
+	name := "cloudendpoint-" + parent.Name
+	now := metav1.NewMicroTime(time.Now())
+	duration := int32(endpointLeaseDurationSeconds)
+
+	lease, err := leases.Get(name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(&coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: parent.Namespace,
+				OwnerReferences: []metav1.OwnerReference{
+					{
+						APIVersion: schemeGroupVersion.String(),
+						Kind:       "CloudEndpoint",
+						Name:       parent.Name,
+						UID:        parent.UID,
+					},
+				},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &identity,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	held := lease.Spec.HolderIdentity != nil && *lease.Spec.HolderIdentity == identity
+	expired := lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil ||
+		now.Time.After(lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds)*time.Second))
+	if held == false && expired == false {
+		return false, nil
+	}
+	if held && expired == false && now.Time.Before(lease.Spec.RenewTime.Add(time.Duration(duration/2)*time.Second)) {
+		return true, nil
+	}
+
+	if held == false {
+		lease.Spec.HolderIdentity = &identity
+		lease.Spec.AcquireTime = &now
+	}
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	_, err = leases.Update(lease)
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAcquireEndpointLease(t *testing.T) {
+	env := newTestEnv(nil, nil)
+	parent := newTestParent()
+	leases := env.clientset.CoordinationV1().Leases(parent.Namespace)
+
+	if ok, err := acquireEndpointLease("replica-a", parent); err != nil || ok == false {
+		t.Fatalf("acquireEndpointLease(replica-a) = %v, %v, want the new lease", ok, err)
+	}
+	lease, err := leases.Get("cloudendpoint-svc1", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("lease not created: %v", err)
+	}
+	if *lease.Spec.HolderIdentity != "replica-a" || lease.OwnerReferences[0].UID != parent.UID {
+		t.Errorf("lease holder = %s, owner = %v", *lease.Spec.HolderIdentity, lease.OwnerReferences)
+	}
+
+	if ok, err := acquireEndpointLease("replica-a", parent); err != nil || ok == false {
+		t.Errorf("acquireEndpointLease(replica-a) again = %v, %v, want the held lease", ok, err)
+	}
+	if ok, err := acquireEndpointLease("replica-b", parent); err != nil || ok {
+		t.Errorf("acquireEndpointLease(replica-b) = %v, %v, want false while replica-a holds the lease", ok, err)
+	}
+
+	expired := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	lease.Spec.RenewTime = &expired
+	if _, err := leases.Update(lease); err != nil {
+		t.Fatalf("failed to expire lease: %v", err)
+	}
+	if ok, err := acquireEndpointLease("replica-b", parent); err != nil || ok == false {
+		t.Errorf("acquireEndpointLease(replica-b) = %v, %v, want the expired lease", ok, err)
+	}
+	lease, _ = leases.Get("cloudendpoint-svc1", metav1.GetOptions{})
+	if *lease.Spec.HolderIdentity != "replica-b" || lease.Spec.RenewTime.Time.Before(time.Now().Add(-time.Second)) {
+		t.Errorf("lease holder = %s, renewTime = %v, want a renewed replica-b lease", *lease.Spec.HolderIdentity, lease.Spec.RenewTime)
+	}
+}
+
+func TestLockSync(t *testing.T) {
+	newTestEnv(nil, nil)
+	config.LeaderElect = true
+	config.identity = "replica-a"
+	parent := newTestParent()
+	logger := logrus.NewEntry(rootLogger)
+
+	unlock, ok := lockSync(logger, parent)
+	if ok == false {
+		t.Fatalf("lockSync() = false, want the lease")
+	}
+	unlock()
+
+	config.identity = "replica-b"
+	if _, ok := lockSync(logger, parent); ok {
+		t.Errorf("lockSync() = true while another replica holds the lease")
+	}
+	config.LeaderElect = false
+	if unlock, ok := lockSync(logger, parent); ok == false {
+		t.Errorf("lockSync() without leader election = false")
+	} else {
+		unlock()
+	}
+}
+
+func TestReadyzHandler(t *testing.T) {
+	defer setLeader(isLeader())
+	for _, active := range []bool{false, true} {
+		setLeader(active)
+		w := httptest.NewRecorder()
+		readyzHandler()(w, httptest.NewRequest("GET", "/readyz", nil))
+		want := http.StatusServiceUnavailable
+		if active {
+			want = http.StatusOK
+		}
+		if w.Code != want {
+			t.Errorf("readyz with leader %v = %d, want %d", active, w.Code, want)
+		}
+	}
+}
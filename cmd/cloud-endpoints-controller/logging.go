@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rootLogger writes JSON log entries to stderr, the level is set from the --log-level flag.
+var rootLogger = &logrus.Logger{
+	Out:       os.Stderr,
+	Formatter: &logrus.JSONFormatter{},
+	Hooks:     make(logrus.LevelHooks),
+	Level:     logrus.InfoLevel,
+}
+
+type loggerKey struct{}
+
+// configureLogging sets the level of the root logger.
+func configureLogging(level string) error {
+	lvl, err := logrus.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	rootLogger.SetLevel(lvl)
+	return nil
+}
+
+// newSyncContext returns a context carrying a logger with the object fields and a new correlation id for a single hook call.
+func newSyncContext(hook string, parent *CloudEndpoint) (context.Context, *logrus.Entry) {
+	logger := rootLogger.WithFields(logrus.Fields{
+		"syncId":    newSyncID(),
+		"hook":      hook,
+		"namespace": parent.Namespace,
+		"name":      parent.Name,
+		"uid":       string(parent.UID),
+		"state":     parent.Status.StateCurrent,
+	})
+	if parent.Status.Endpoint != "" {
+		logger = logger.WithField("endpoint", parent.Status.Endpoint)
+	}
+	return withLogger(context.Background(), logger), logger
+}
+
+func withLogger(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// loggerFrom returns the logger stored in the context, or an entry of the root logger.
+func loggerFrom(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(loggerKey{}).(*logrus.Entry); ok == true {
+		return logger
+	}
+	return logrus.NewEntry(rootLogger)
+}
+
+func newSyncID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
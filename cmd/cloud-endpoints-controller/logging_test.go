@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestNewSyncContext(t *testing.T) {
+	var buf bytes.Buffer
+	out := rootLogger.Out
+	rootLogger.Out = &buf
+	defer func() { rootLogger.Out = out }()
+
+	parent := newTestParent()
+	parent.Status = CloudEndpointControllerStatus{StateCurrent: StateIdle, Endpoint: testEndpoint}
+	ctx, _ := newSyncContext("sync", parent)
+	loggerFrom(ctx).Info("test entry")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("log entry is not JSON: %v, %s", err, buf.String())
+	}
+	want := map[string]string{"hook": "sync", "namespace": "default", "name": "svc1", "uid": "uid-svc1", "state": StateIdle, "endpoint": testEndpoint, "msg": "test entry"}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("log entry %s = %v, want %s", k, entry[k], v)
+		}
+	}
+	if id, _ := entry["syncId"].(string); len(id) != 16 {
+		t.Errorf("syncId = %v, want 16 hex characters", entry["syncId"])
+	}
+}
+
+func TestConfigureLogging(t *testing.T) {
+	defer rootLogger.SetLevel(rootLogger.Level)
+	if err := configureLogging("debug"); err != nil || rootLogger.Level != logrus.DebugLevel {
+		t.Errorf("configureLogging(debug) = %v, level = %s", err, rootLogger.Level)
+	}
+	if err := configureLogging("verbose"); err == nil {
+		t.Errorf("configureLogging(verbose) = nil, want an error")
+	}
+	if entry := loggerFrom(context.Background()); entry.Logger != rootLogger {
+		t.Errorf("loggerFrom() without a logger does not use the root logger")
+	}
+}
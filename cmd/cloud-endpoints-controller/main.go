@@ -2,23 +2,25 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"net"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/ghodss/yaml"
-
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
 	servicemanagement "google.golang.org/api/servicemanagement/v1"
 	corev1 "k8s.io/api/core/v1"
-	"k8s.io/api/extensions/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -27,23 +29,57 @@ var (
 	templatePath string
 )
 
-func init() {
-	config = Config{
-		Project:    "", // Derived from instance metadata server
-		ProjectNum: "", // Derived from instance metadata server
+const (
+	// Base delay before retrying a failed sync, doubled on every consecutive failure.
+	backoffBaseSeconds = 10
+	// Maximum delay between retries.
+	backoffMaxSeconds = 600
+	// Number of consecutive failures after which the CloudEndpoint is moved to the FAILED state.
+	maxFailedAttempts = 10
+)
+
+func main() {
+	config.registerFlags(flag.CommandLine)
+	flag.Parse()
+
+	if err := configureLogging(config.LogLevel); err != nil {
+		rootLogger.WithError(err).Fatal("Invalid log level")
 	}
 
 	if err := config.loadAndValidate(); err != nil {
-		log.Fatalf("Error loading config: %v", err)
+		rootLogger.WithError(err).Fatal("Error loading config")
 	}
-}
 
-func main() {
+	config.identity = replicaIdentity()
+
 	http.HandleFunc("/healthz", healthzHandler())
-	http.HandleFunc("/", webhookHandler())
+	http.HandleFunc("/readyz", readyzHandler())
+	http.Handle("/metrics", promhttp.Handler())
 
-	log.Printf("[INFO] Initialized controller on port 80\n")
-	log.Fatal(http.ListenAndServe(":80", nil))
+	switch config.Mode {
+	case ModeMetacontroller:
+		// Every replica serves the hooks, concurrent syncs of the same CloudEndpoint are prevented by lockSync.
+		setLeader(true)
+		http.HandleFunc("/finalize", finalizeHandler())
+		http.HandleFunc("/", webhookHandler())
+	case ModeStandalone:
+		run := func(stopCh <-chan struct{}) {
+			if err := runStandalone(config.Workers, stopCh); err != nil {
+				rootLogger.WithError(err).Fatal("Error running standalone controller")
+			}
+		}
+		if config.LeaderElect {
+			go runLeaderElection(config.identity, run)
+		} else {
+			setLeader(true)
+			go run(make(chan struct{}))
+		}
+	default:
+		rootLogger.WithField("mode", config.Mode).Fatalf("Invalid mode, must be one of: %s, %s", ModeMetacontroller, ModeStandalone)
+	}
+
+	rootLogger.WithField("listenAddress", config.ListenAddress).Info("Initialized controller")
+	rootLogger.Fatal(http.ListenAndServe(config.ListenAddress, nil))
 }
 
 func healthzHandler() func(w http.ResponseWriter, r *http.Request) {
@@ -64,14 +100,21 @@ func webhookHandler() func(w http.ResponseWriter, r *http.Request) {
 		decoder := json.NewDecoder(r.Body)
 		if err := decoder.Decode(&req); err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Printf("[ERROR] Could not parse SyncRequest: %v", err)
+			rootLogger.WithError(err).Error("Could not parse SyncRequest")
 			return
 		}
 
-		desiredStatus, desiredChildren, err := sync(&req.Parent, &req.Children)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			log.Printf("[ERROR] Could not sync state: %v", err)
+		// The sync error is reported in the Ready condition, the response is still returned
+		// because metacontroller discards the status of a failed hook.
+		ctx, logger := newSyncContext("sync", &req.Parent)
+		var err error
+		desiredStatus, desiredChildren := &req.Parent.Status, &[]interface{}{}
+		if unlock, ok := lockSync(logger, &req.Parent); ok {
+			desiredStatus, desiredChildren, err = sync(ctx, &req.Parent, &req.Children)
+			unlock()
+			if err != nil {
+				logger.WithError(err).Error("Could not sync state")
+			}
 		}
 
 		resp := SyncResponse{
@@ -82,15 +125,67 @@ func webhookHandler() func(w http.ResponseWriter, r *http.Request) {
 		data, err := json.Marshal(resp)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
-			log.Printf("[ERROR] Could not generate SyncResponse: %v", err)
+			logger.WithError(err).Error("Could not generate SyncResponse")
 			return
 		}
 		fmt.Fprintf(w, string(data))
 	}
 }
 
-func sync(parent *CloudEndpoint, children *CloudEndpointControllerRequestChildren) (*CloudEndpointControllerStatus, *[]interface{}, error) {
+func finalizeHandler() func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Unsupported method\n")
+			return
+		}
+
+		var req SyncRequest
+		decoder := json.NewDecoder(r.Body)
+		if err := decoder.Decode(&req); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			rootLogger.WithError(err).Error("Could not parse SyncRequest")
+			return
+		}
+
+		ctx, logger := newSyncContext("finalize", &req.Parent)
+		var err error
+		desiredStatus, desiredChildren, finalized := &req.Parent.Status, &[]interface{}{}, false
+		if unlock, ok := lockSync(logger, &req.Parent); ok {
+			desiredStatus, desiredChildren, finalized, err = finalize(ctx, &req.Parent, &req.Children)
+			unlock()
+			if err != nil {
+				w.WriteHeader(http.StatusInternalServerError)
+				logger.WithError(err).Error("Could not finalize state")
+			}
+		}
+
+		resp := SyncResponse{
+			Status:    *desiredStatus,
+			Children:  *desiredChildren,
+			Finalized: finalized,
+		}
+
+		data, err := json.Marshal(resp)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			logger.WithError(err).Error("Could not generate SyncResponse")
+			return
+		}
+		fmt.Fprintf(w, string(data))
+	}
+}
+
+func sync(ctx context.Context, parent *CloudEndpoint, children *CloudEndpointControllerRequestChildren) (_ *CloudEndpointControllerStatus, _ *[]interface{}, err error) {
+	start := time.Now()
+	logger := loggerFrom(ctx)
 	status := makeStatus(parent, children)
+	status.ObservedGeneration = parent.Generation
+	defer func() {
+		updateReadyCondition(status, err)
+		recordSyncEvents(parent, status, err)
+		observeSync("sync", start, parent, status, err)
+	}()
 	currState := status.StateCurrent
 	if currState == "" {
 		currState = StateIdle
@@ -98,93 +193,375 @@ func sync(parent *CloudEndpoint, children *CloudEndpointControllerRequestChildre
 	desiredChildren := make([]interface{}, 0)
 	nextState := currState[0:1] + currState[1:] // string copy of currState
 
-	changed := changeDetected(parent, children, status)
+	syncStaticIP(ctx, parent, status)
+
+	changed := changeDetected(ctx, parent, children, status)
+
+	syncManagedCertificate(ctx, parent, status)
+
+	if currState == StateBackoff {
+		if status.NextRetryTime != nil && time.Now().Before(status.NextRetryTime.Time) {
+			return status, &desiredChildren, nil
+		}
+		logger.WithFields(logrus.Fields{"attempt": status.FailedAttempts + 1, "state": status.BackoffState}).Info("Retrying after backoff")
+		if status.BackoffState != "" {
+			// Poll the pending operation again, it may still complete.
+			currState = status.BackoffState
+			nextState = currState
+		} else {
+			currState = StateIdle
+			changed = true
+		}
+		status.BackoffState = ""
+	}
+
+	if currState == StateFailed && changed {
+		// Start over with a fresh retry budget when something changes after a terminal failure.
+		status.FailedAttempts = 0
+		currState = StateIdle
+	}
 
 	if currState == StateIdle && changed {
 		status.Endpoint = fmt.Sprintf("%s.endpoints.%s.cloud.goog", parent.Name, parent.Spec.Project)
+		logger = logger.WithField("endpoint", status.Endpoint)
+		ctx = withLogger(ctx, logger)
 
 		// Check if endpoint service exists, if not then create it.
 		ep := status.Endpoint
-		currService, err := config.clientServiceMan.Services.Get(ep).Do()
-		if err != nil {
-			if strings.Contains(err.Error(), "not found or permission denied") || (currService != nil && currService.HTTPStatusCode == 403) {
-				log.Printf("[INFO][%s] Service does not yet exist, creating: %s", parent.Name, ep)
-				_, err := config.clientServiceMan.Services.Create(&servicemanagement.ManagedService{
+		_, err := config.clientServiceMan.GetService(ctx, ep)
+		if err != nil && parent.Spec.DryRun {
+			// Render and validate the config for the endpoint name without creating or undeleting the service.
+			logger.Info("Dry run, skipping service create")
+			status.setCondition(ConditionServiceCreated, corev1.ConditionFalse, "DryRun", fmt.Sprintf("Service %s not created because spec.dryRun is true", ep))
+		} else if err != nil {
+			if serviceNotVisible(err) {
+				logger.Info("Service does not yet exist, creating")
+				_, err := config.clientServiceMan.CreateService(ctx, &servicemanagement.ManagedService{
 					ProducerProjectId: parent.Spec.Project,
 					ServiceName:       ep,
-				}).Do()
-				if err != nil {
-					return status, &desiredChildren, fmt.Errorf("[ERROR] Failed to creat Cloud Endpoints service: serviceName: %s, err: %v", ep, err)
+				})
+				if err != nil && serviceSoftDeleted(err) {
+					// Service was deleted within the last 30 days, restore it instead of creating a new one.
+					logger.Info("Service was previously deleted, undeleting")
+					_, err = config.clientServiceMan.UndeleteService(ctx, ep)
+					if err != nil {
+						status.setCondition(ConditionServiceCreated, corev1.ConditionFalse, "UndeleteFailed", err.Error())
+						return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Failed to undelete Cloud Endpoints service: %s, %v", ep, err))
+					}
+					recordEvent(parent, corev1.EventTypeNormal, "ServiceUndeleted", "Undeleted Cloud Endpoints service %s", ep)
+				} else if err != nil {
+					status.setCondition(ConditionServiceCreated, corev1.ConditionFalse, "CreateFailed", err.Error())
+					return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Failed to create Cloud Endpoints service: %s, %v", ep, err))
+				} else {
+					recordEvent(parent, corev1.EventTypeNormal, "ServiceCreated", "Created Cloud Endpoints service %s", ep)
 				}
 			} else {
-				return status, &desiredChildren, fmt.Errorf("[ERROR][%s] Failed to get existing endpoint service: %v", parent.Name, err)
+				status.setCondition(ConditionServiceCreated, corev1.ConditionFalse, "GetFailed", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Failed to get existing endpoint service: %s, %v", ep, err))
 			}
 		} else {
-			log.Printf("[INFO][%s] Endpoint service already exists, skipping create.", parent.Name)
+			logger.Info("Endpoint service already exists, skipping create")
+			status.setCondition(ConditionServiceCreated, corev1.ConditionTrue, "ServiceExists", ep)
 		}
 
+		status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "Pending", "Change detected, waiting for service config submit")
+		status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "Pending", "Change detected, waiting for service config rollout")
+
 		nextState = StateEndpointCreatePending
 
 	}
 
-	if currState == StateEndpointCreatePending {
-		log.Printf("[INFO][%s] Create pending", parent.Name)
+	if currState == StateEndpointCreatePending && parent.Spec.PinnedConfigID != "" {
+		// Roll out an existing config without rendering or submitting new sources.
+		ep := status.Endpoint
+		cfg := parent.Spec.PinnedConfigID
+		_, err := config.clientServiceMan.GetConfig(ctx, ep, cfg)
+		if err != nil {
+			status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "PinnedConfigNotFound", err.Error())
+			return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Failed to get pinned config for: endpoint: %s, config: %s, %v", ep, cfg, err))
+		}
+		logger.WithField("config", cfg).Info("Using pinned config")
+		status.Config = cfg
+		status.ConfigSubmit = "NA"
+		status.LastAppliedSig = calcParentSig(parent, "")
+
+		nextState = StateEndpointSubmitPending
+	}
+
+	if currState == StateEndpointCreatePending && parent.Spec.PinnedConfigID == "" {
+		logger.Info("Create pending")
 		var target string
+		var targets []string
 		var openAPISpecTemplate string
 		var err error
 
+		family, err := targetAddressFamily(parent)
+		if err != nil {
+			status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "InvalidAddressFamily", err.Error())
+			return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+		}
+
+		// A reserved static IP is the target, the ingress is still resolved for the JWT audiences.
+		staticAddress := ""
+		if parent.Spec.StaticIP != nil {
+			if status.StaticIP == nil || status.StaticIP.Address == "" {
+				logger.Info("Waiting for static IP")
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "WaitingForStaticIP", fmt.Sprintf("Waiting for global static IP %s", staticIPName(parent)))
+				return status, &desiredChildren, nil
+			}
+			staticAddress = status.StaticIP.Address
+		}
+
 		if parent.Spec.TargetIngress.Name != "" {
-			target, status.JWTAudiences, err = getTargetIngress(parent)
-			if err != nil { // fatal error with Target Ingress
-				log.Printf("[INFO][%s] error with target ingress deployment, %v", parent.Name, err)
-				return status, &desiredChildren, err
-			} else if target == "" { //waiting on Target Ingress
-				return status, &desiredChildren, err
+			targets, status.JWTAudiences, err = getTargetIngress(ctx, parent)
+			if _, ok := err.(referenceNotAllowedError); ok { // wait for the target namespace to allow the reference
+				logger.Info(err.Error())
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "ReferenceNotAllowed", err.Error())
+				recordEvent(parent, corev1.EventTypeWarning, "ReferenceNotAllowed", "%s", err.Error())
+				return status, &desiredChildren, nil
+			} else if err != nil { // fatal error with Target Ingress
+				logger.WithError(err).Warn("Error with target ingress deployment")
+				reason := "TargetIngressError"
+				if _, ok := err.(jwtBackendNotFoundError); ok {
+					reason = "JWTBackendNotFound"
+				}
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, reason, err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			} else if len(targets) == 0 && (staticAddress == "" || len(parent.Spec.TargetIngress.JWTServices) > 0) { //waiting on Target Ingress
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "WaitingForIngress", fmt.Sprintf("Waiting for load balancer status from Ingress %s", parent.Spec.TargetIngress.Name))
+				return status, &desiredChildren, nil
 			}
-		} else {
+		} else if parent.Spec.TargetService != nil && staticAddress == "" {
+			targets, err = getTargetService(ctx, parent)
+			if _, ok := err.(referenceNotAllowedError); ok {
+				logger.Info(err.Error())
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "ReferenceNotAllowed", err.Error())
+				recordEvent(parent, corev1.EventTypeWarning, "ReferenceNotAllowed", "%s", err.Error())
+				return status, &desiredChildren, nil
+			} else if err != nil {
+				logger.WithError(err).Warn("Error with target service")
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "TargetServiceError", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			} else if len(targets) == 0 {
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "WaitingForService", fmt.Sprintf("Waiting for load balancer status from Service %s", parent.Spec.TargetService.Name))
+				return status, &desiredChildren, nil
+			}
+		} else if staticAddress == "" {
 			target = parent.Spec.Target
+			if target != "" {
+				targets = []string{target}
+			}
 		}
-		status.IngressIP = target
-		if openAPISpecTemplate = parent.Spec.OpenAPISpec; openAPISpecTemplate == "" {
-			if name, key := parent.Spec.OpenAPISpecConfigMap.Name, parent.Spec.OpenAPISpecConfigMap.Key; name != "" && key != "" {
-				openAPISpecTemplate, err = getConfigMapSpecData(parent.ObjectMeta.Namespace, name, key)
-				if err != nil { //The user tried to supply a configMap spec, but it could not be loaded yet
-					log.Printf("[INFO][%s] Waiting for ConfigMap with Spec named '%s' containing key: '%s'", parent.Name, name, key)
-					return status, &desiredChildren, nil
-				}
-				status.ConfigMapHash = toSha1(openAPISpecTemplate)
-			} else {
-				openAPISpecTemplate = getWildcardAPITemplate()
+		if staticAddress != "" {
+			target = staticAddress
+			targets = append([]string{staticAddress}, removeString(targets, staticAddress)...)
+		} else if target == "" && len(targets) > 0 {
+			if target = selectTarget(ctx, targets, family); target == "" {
+				logger.WithFields(logrus.Fields{"addresses": targets, "family": family}).Info("Waiting for target address of the address family")
+				status.setCondition(ConditionTargetResolved, corev1.ConditionFalse, "WaitingForAddress", fmt.Sprintf("Waiting for an %s address, found: %s", family, strings.Join(targets, ", ")))
+				return status, &desiredChildren, nil
 			}
 		}
-		finalOpenAPISpec, err := executeTemplate(openAPISpecTemplate, status.Endpoint, target, status.JWTAudiences)
+		status.IngressIP = target
+		status.setCondition(ConditionTargetResolved, corev1.ConditionTrue, "TargetResolved", target)
+
+		providers, err := authProviders(parent, status.JWTAudiences)
 		if err != nil {
-			log.Printf("[ERROR][%s] %v", parent.Name, err)
-			return status, &desiredChildren, err
+			status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+			return status, &desiredChildren, recordFailure(ctx, parent, status, err)
 		}
-		if err := validateOpenAPISpec(finalOpenAPISpec); err != nil {
-			status.StateCurrent = StateIdle
-			return status, &desiredChildren, err
+		templateData := newTemplateData(status.Endpoint, target, targets, status.JWTAudiences, providers)
+
+		var configFiles []*servicemanagement.ConfigFile
+		if parent.Spec.GRPC != nil {
+			if parent.Spec.APIKeys != nil || parent.Spec.Quota != nil {
+				err := fmt.Errorf("apiKeys and quota are not supported with grpc, set them in the gRPC service config")
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			descriptorSet, serviceConfigTemplate, err := getGRPCSources(parent.ObjectMeta.Namespace, parent.Spec.GRPC)
+			if err != nil {
+				if _, ok := err.(sourceNotFoundError); ok { // The user referenced a ConfigMap or Secret that could not be loaded yet
+					logger.Info(err.Error())
+					status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "WaitingForGRPCSource", err.Error())
+					recordEvent(parent, corev1.EventTypeWarning, "WaitingForGRPCSource", "%s", err.Error())
+					return status, &desiredChildren, nil
+				}
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			status.ConfigMapHash = grpcSourceHash(descriptorSet, serviceConfigTemplate)
+
+			finalServiceConfig, err := executeTemplate(serviceConfigTemplate, templateData)
+			if err != nil {
+				logger.WithError(err).Error("Failed to render service config template")
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "TemplateError", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			if err := validateGRPCServiceConfig(finalServiceConfig); err != nil {
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			configFiles = makeGRPCConfigFiles(descriptorSet, finalServiceConfig)
+		} else if len(parent.Spec.OpenAPISpecFrom) > 0 {
+			specFiles, err := getOpenAPISpecSources(parent.ObjectMeta.Namespace, parent.Spec.OpenAPISpecFrom)
+			if err != nil {
+				if _, ok := err.(sourceNotFoundError); ok { // The user referenced a ConfigMap or Secret that could not be loaded yet
+					logger.Info(err.Error())
+					status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "WaitingForSpecSource", err.Error())
+					recordEvent(parent, corev1.EventTypeWarning, "WaitingForSpecSource", "%s", err.Error())
+					return status, &desiredChildren, nil
+				}
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "SpecSourceError", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			if status.ConfigMapHash, err = openAPISourcesHash(parent.ObjectMeta.Namespace, parent.Spec.OpenAPISpecFrom); err != nil {
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "SpecSourceError", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+
+			status.ValidationDiagnostics = make([]string, 0)
+			for _, f := range specFiles {
+				finalOpenAPISpec, err := executeTemplate(f.contents, templateData)
+				if err != nil {
+					logger.WithError(err).WithField("file", f.path).Error("Failed to render OpenAPI spec template")
+					status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "TemplateError", fmt.Sprintf("%s: %v", f.path, err))
+					return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("%s: %v", f.path, err))
+				}
+				finalOpenAPISpec, err = applyAPIManagement(parent, finalOpenAPISpec, openAPIFileType(f.path) == "OPEN_API_JSON")
+				if err != nil {
+					for _, d := range validationDiagnostics(err) {
+						status.ValidationDiagnostics = append(status.ValidationDiagnostics, fmt.Sprintf("%s: %s", f.path, d))
+					}
+					continue
+				}
+				if err := validateOpenAPISpec(finalOpenAPISpec, status.Endpoint); err != nil {
+					for _, d := range validationDiagnostics(err) {
+						status.ValidationDiagnostics = append(status.ValidationDiagnostics, fmt.Sprintf("%s: %s", f.path, d))
+					}
+				}
+				configFiles = append(configFiles, &servicemanagement.ConfigFile{
+					FileContents: base64.StdEncoding.EncodeToString([]byte(finalOpenAPISpec)),
+					FilePath:     f.path,
+					FileType:     openAPIFileType(f.path),
+				})
+			}
+			if len(status.ValidationDiagnostics) > 0 {
+				err := &validationError{diagnostics: status.ValidationDiagnostics}
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+		} else {
+			if openAPISpecTemplate = parent.Spec.OpenAPISpec; openAPISpecTemplate == "" {
+				if name, key := parent.Spec.OpenAPISpecConfigMap.Name, parent.Spec.OpenAPISpecConfigMap.Key; name != "" && key != "" {
+					openAPISpecTemplate, err = getConfigMapSpecData(parent.ObjectMeta.Namespace, name, key)
+					if err != nil { //The user tried to supply a configMap spec, but it could not be loaded yet
+						logger.WithFields(logrus.Fields{"configMap": name, "key": key}).Info("Waiting for ConfigMap with spec")
+						status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "WaitingForConfigMap", fmt.Sprintf("Waiting for ConfigMap '%s' containing key: '%s'", name, key))
+						recordEvent(parent, corev1.EventTypeWarning, "ConfigMapNotFound", "ConfigMap '%s' containing key '%s' not found", name, key)
+						return status, &desiredChildren, nil
+					}
+					status.ConfigMapHash = toSha1(openAPISpecTemplate)
+				} else {
+					openAPISpecTemplate, status.ConfigMapHash, err = wildcardAPITemplate(parent)
+					if _, ok := err.(sourceNotFoundError); ok {
+						logger.Info(err.Error())
+						status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "WaitingForIngress", err.Error())
+						return status, &desiredChildren, nil
+					} else if err != nil {
+						status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+						return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+					}
+				}
+			}
+			finalOpenAPISpec, err := executeTemplate(openAPISpecTemplate, templateData)
+			if err != nil {
+				logger.WithError(err).Error("Failed to render OpenAPI spec template")
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "TemplateError", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			finalOpenAPISpec, err = applyAPIManagement(parent, finalOpenAPISpec, false)
+			if err == nil {
+				err = validateOpenAPISpec(finalOpenAPISpec, status.Endpoint)
+			}
+			if err != nil {
+				status.ValidationDiagnostics = validationDiagnostics(err)
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "InvalidSpec", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+			}
+			configFiles = []*servicemanagement.ConfigFile{
+				&servicemanagement.ConfigFile{
+					FileContents: base64.StdEncoding.EncodeToString([]byte(finalOpenAPISpec)),
+					FilePath:     "openapi.yaml",
+					FileType:     "OPEN_API_YAML",
+				},
+			}
 		}
+		status.setCondition(ConditionSpecValid, corev1.ConditionTrue, "Valid", "")
 
 		// Submit endpoint config if service exists.
 		ep := status.Endpoint
-		_, err = config.clientServiceMan.Services.Get(ep).Do()
-		if err != nil {
-			log.Printf("[INFO][%s] Waiting for Endpoint creation: %s", parent.Name, ep)
+		_, err = config.clientServiceMan.GetService(ctx, ep)
+		serviceExists := err == nil
+		if serviceExists {
+			status.setCondition(ConditionServiceCreated, corev1.ConditionTrue, "ServiceExists", ep)
+		} else if parent.Spec.DryRun == false {
+			logger.Info("Waiting for endpoint creation")
+			status.setCondition(ConditionServiceCreated, corev1.ConditionFalse, "Pending", fmt.Sprintf("Waiting for endpoint service creation: %s", ep))
 			return status, &desiredChildren, nil
 		}
 
-		log.Printf("[INFO][%s] Endpoint created: %s, submitting endpoint config.", parent.Name, ep)
+		filesHash := configFilesHash(configFiles)
+		if h := status.findConfigHistory(filesHash); h != nil && parent.Spec.DryRun == false {
+			// The rendered config was already submitted, roll out the existing config instead of submitting a duplicate.
+			logger.WithField("config", h.Config).Info("Rendered config is identical to a previous config, skipping submit")
+			status.Config = h.Config
+			status.ConfigSubmit = "NA"
+			status.LastAppliedSig = calcParentSig(parent, "")
+			status.StateCurrent = StateEndpointSubmitPending
+			logger.WithField("state", StateEndpointSubmitPending).Info("State changed")
+			return status, &desiredChildren, nil
+		}
 
-		configFiles := []*servicemanagement.ConfigFile{
-			&servicemanagement.ConfigFile{
-				FileContents: base64.StdEncoding.EncodeToString([]byte(finalOpenAPISpec)),
-				FilePath:     "openapi.yaml",
-				FileType:     "OPEN_API_YAML",
-			},
+		// Server side validation needs an existing service, a dry run of a new endpoint is only validated locally.
+		if parent.Spec.ServerSideValidation && status.ValidatedConfigHash != filesHash && serviceExists {
+			logger.Info("Validating endpoint config with Service Management")
+			op, err := config.clientServiceMan.SubmitConfig(ctx, ep, &servicemanagement.SubmitConfigSourceRequest{
+				ValidateOnly: true,
+				ConfigSource: &servicemanagement.ConfigSource{
+					Files: configFiles,
+				},
+			})
+			if err != nil {
+				status.ValidationDiagnostics = []string{err.Error()}
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "ServerValidationFailed", err.Error())
+				return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Failed to validate endpoint config: %v", err))
+			}
+			status.ConfigValidate = op.Name
+			status.ValidatedConfigHash = filesHash
+			status.StateCurrent = StateEndpointValidatePending
+			logger.WithFields(logrus.Fields{"state": StateEndpointValidatePending, "operation": op.Name}).Info("State changed")
+			return status, &desiredChildren, nil
+		}
+		status.ValidationDiagnostics = make([]string, 0)
+
+		if parent.Spec.DryRun {
+			logger.Info("Dry run, skipping config submit")
+			msg := "Config is valid, not submitted because spec.dryRun is true"
+			if parent.Spec.ServerSideValidation && serviceExists == false {
+				msg = fmt.Sprintf("Config is valid, server side validation skipped because service %s does not exist, not submitted because spec.dryRun is true", ep)
+			}
+			status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "DryRun", msg)
+			status.LastAppliedSig = calcParentSig(parent, "")
+			if status.StateCurrent != StateIdle {
+				logger.WithField("state", StateIdle).Info("State changed")
+			}
+			status.StateCurrent = StateIdle
+			return status, &desiredChildren, nil
 		}
 
+		logger.Info("Endpoint created, submitting endpoint config")
+
 		req := servicemanagement.SubmitConfigSourceRequest{
 			ValidateOnly: false,
 			ConfigSource: &servicemanagement.ConfigSource{
@@ -192,34 +569,71 @@ func sync(parent *CloudEndpoint, children *CloudEndpointControllerRequestChildre
 			},
 		}
 
-		op, err := config.clientServiceMan.Services.Configs.Submit(ep, &req).Do()
+		op, err := config.clientServiceMan.SubmitConfig(ctx, ep, &req)
 		if err != nil {
-			return status, &desiredChildren, fmt.Errorf("Failed to submit endpoint config: %v", err)
+			status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "SubmitFailed", err.Error())
+			return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Failed to submit endpoint config: %v", err))
 		}
 		status.ConfigSubmit = op.Name
+		status.SubmittedConfigHash = filesHash
+		status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "SubmitPending", fmt.Sprintf("Waiting for submit operation: %s", op.Name))
 
 		nextState = StateEndpointSubmitPending
 		status.LastAppliedSig = calcParentSig(parent, "")
 	}
 
+	if currState == StateEndpointValidatePending {
+		ep := status.Endpoint
+		op, err := config.clientServiceMan.GetOperation(ctx, status.ConfigValidate)
+		if err != nil {
+			return status, &desiredChildren, recordPollFailure(ctx, status, currState, fmt.Errorf("Failed to get service config validate operation id: %s, %v", status.ConfigValidate, err))
+		}
+		if op.Done {
+			status.ValidationDiagnostics = getOperationDiagnostics(op)
+			if op.Error != nil {
+				status.ValidatedConfigHash = ""
+				status.setCondition(ConditionSpecValid, corev1.ConditionFalse, "ServerValidationFailed", op.Error.Message)
+				return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Service config validation failed for endpoint %s: %s", ep, op.Error.Message))
+			}
+			logger.Info("Service config validation passed")
+			nextState = StateEndpointCreatePending
+		}
+	}
+
 	if currState == StateEndpointSubmitPending {
 		ep := status.Endpoint
 		opDone := true
 		submitID := status.ConfigSubmit
 		if submitID != "NA" {
-			op, err := config.clientServiceMan.Operations.Get(submitID).Do()
+			op, err := config.clientServiceMan.GetOperation(ctx, submitID)
 			if err != nil {
-				return status, &desiredChildren, fmt.Errorf("Failed to get service submit operation id: %s", status.ConfigSubmit)
+				return status, &desiredChildren, recordPollFailure(ctx, status, currState, fmt.Errorf("Failed to get service submit operation id: %s, %v", status.ConfigSubmit, err))
 			}
 			opDone = op.Done
 
-			var r servicemanagement.SubmitConfigSourceResponse
-			data, _ := op.Response.MarshalJSON()
-			if err := json.Unmarshal(data, &r); err != nil {
-				return status, &desiredChildren, err
+			if opDone && op.Error != nil {
+				status.setCondition(ConditionConfigSubmitted, corev1.ConditionFalse, "SubmitFailed", op.Error.Message)
+				return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Service config submit failed for endpoint %s: %s", ep, op.Error.Message))
+			}
+
+			if opDone {
+				var r servicemanagement.SubmitConfigSourceResponse
+				data, _ := op.Response.MarshalJSON()
+				if err := json.Unmarshal(data, &r); err != nil {
+					return status, &desiredChildren, recordFailure(ctx, parent, status, err)
+				}
+				if r.ServiceConfig == nil {
+					return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Service config submit operation %s did not return a service config", submitID))
+				}
+				logger.WithField("config", r.ServiceConfig.Id).Info("Service config submit complete")
+				status.Config = r.ServiceConfig.Id
+				status.addConfigHistory(r.ServiceConfig.Id, status.LastAppliedSig, status.SubmittedConfigHash, parent.Spec.ConfigHistoryLimit)
+				recordEvent(parent, corev1.EventTypeNormal, "ConfigSubmitted", "Submitted service config %s for endpoint %s", r.ServiceConfig.Id, ep)
 			}
-			log.Printf("[INFO][%s] Service config submit complete for endpoint %s, config: %s", parent.Name, ep, r.ServiceConfig.Id)
-			status.Config = r.ServiceConfig.Id
+		}
+
+		if opDone {
+			status.setCondition(ConditionConfigSubmitted, corev1.ConditionTrue, "ConfigSubmitted", status.Config)
 		}
 
 		cfg := status.Config
@@ -227,92 +641,220 @@ func sync(parent *CloudEndpoint, children *CloudEndpointControllerRequestChildre
 		if opDone {
 			found := false
 
-			r, err := config.clientServiceMan.Services.Rollouts.List(ep).Do()
+			rollouts, err := config.clientServiceMan.ListRollouts(ctx, ep)
 			if err != nil {
-				return status, &desiredChildren, err
+				return status, &desiredChildren, recordPollFailure(ctx, status, currState, fmt.Errorf("Failed to list rollouts for endpoint: %s, %v", ep, err))
 			}
-			if len(r.Rollouts) > 0 {
-				if _, ok := r.Rollouts[0].TrafficPercentStrategy.Percentages[cfg]; ok == true {
-					log.Printf("[INFO][%s] Rollout for config already found, skipping rollout for endpoint: %s, config: %s", parent.Name, ep, cfg)
+			previousConfig := ""
+			if len(rollouts) > 0 && rollouts[0].TrafficPercentStrategy != nil {
+				percentages := rollouts[0].TrafficPercentStrategy.Percentages
+				// With a staged rollout, a partial rollout of the config is not considered complete.
+				if pct, ok := percentages[cfg]; ok == true && (parent.Spec.Rollout == nil || pct >= 100.0) {
+					logger.WithField("config", cfg).Info("Rollout for config already found, skipping rollout")
 					status.ServiceRollout = "NA"
+					status.setCondition(ConditionRolloutComplete, corev1.ConditionTrue, "RolloutExists", cfg)
 					found = true
 				}
+				previousConfig = getServingConfig(percentages, cfg)
 			}
 
 			if found == false {
 				// Rollout config
-				log.Printf("[INFO][%s] Creating endpoint service config rollout for: endpoint: %s, config: %s", parent.Name, ep, cfg)
-
-				op, err := config.clientServiceMan.Services.Rollouts.Create(ep, &servicemanagement.Rollout{
-					TrafficPercentStrategy: &servicemanagement.TrafficPercentStrategy{
-						Percentages: map[string]float64{
-							cfg: 100.0,
-						},
-					},
-				}).Do()
+				percent := rolloutStepPercent(parent.Spec.Rollout, 0)
+				if previousConfig == "" {
+					percent = 100.0
+				}
+				percentages := rolloutPercentages(cfg, previousConfig, percent)
+				logger.WithFields(logrus.Fields{"config": cfg, "percentages": percentages}).Info("Creating endpoint service config rollout")
+
+				op, err := createRollout(ctx, ep, percentages)
 				if err != nil {
-					return status, &desiredChildren, fmt.Errorf("Failed to create rollout for: endpoint: %s, config: %s", ep, cfg)
+					status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutFailed", err.Error())
+					return status, &desiredChildren, recordPollFailure(ctx, status, currState, fmt.Errorf("Failed to create rollout for: endpoint: %s, config: %s, %v", ep, cfg, err))
 				}
 				status.ServiceRollout = op.Name
+				status.PreviousConfig = previousConfig
+				status.RolloutStep = 0
+				status.RolloutPercentages = percentages
+				status.RolloutAborted = false
+				if abortCleared(parent, status) {
+					status.AbortedConfig = ""
+				}
+				stepTime := metav1.Now()
+				status.RolloutStepTime = &stepTime
+				status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutPending", fmt.Sprintf("Waiting for rollout operation: %s", op.Name))
+				recordEvent(parent, corev1.EventTypeNormal, "RolloutStarted", "Started rollout of config %s for endpoint %s, percentages: %v", cfg, ep, percentages)
 			}
+			nextState = StateEndpointRolloutPending
 		}
-		nextState = StateEndpointRolloutPending
 	}
 
 	if currState == StateEndpointRolloutPending {
 		ep := status.Endpoint
 		opName := status.ServiceRollout
+		opDone := true
 		if opName != "NA" {
-			op, err := config.clientServiceMan.Operations.Get(opName).Do()
+			op, err := config.clientServiceMan.GetOperation(ctx, opName)
 			if err != nil {
-				return status, &desiredChildren, err
+				return status, &desiredChildren, recordPollFailure(ctx, status, currState, fmt.Errorf("Failed to get service rollout operation id: %s, %v", opName, err))
 			}
-			if op.Done {
-				cfg := status.Config
-				log.Printf("[INFO][%s] Service config rollout complete for: endpoint: %s, config: %s", parent.Name, ep, cfg)
+			if op.Done && op.Error != nil {
+				status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutFailed", op.Error.Message)
+				return status, &desiredChildren, recordFailure(ctx, parent, status, fmt.Errorf("Service config rollout failed for endpoint %s: %s", ep, op.Error.Message))
+			}
+			opDone = op.Done
+		}
+		cfg := status.Config
+		if opDone && status.RolloutAborted == false && status.LastAppliedSig != calcParentSig(parent, "") {
+			// The spec changed during a staged or paused rollout, start over with a new config.
+			logger.WithField("config", cfg).Info("Spec changed during rollout, starting a new rollout")
+			status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "SpecChanged", fmt.Sprintf("Rollout of config %s replaced by a new config", cfg))
+
+			nextState = StateIdle
+		} else if opDone && status.RolloutAborted {
+			logger.WithFields(logrus.Fields{"config": cfg, "servingConfig": status.PreviousConfig}).Info("Service config rollout aborted")
+			status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutAborted", fmt.Sprintf("Rollout of config %s aborted, serving config: %s", cfg, status.PreviousConfig))
+			recordEvent(parent, corev1.EventTypeWarning, "RolloutAborted", "Rollout of config %s aborted, serving config: %s", cfg, status.PreviousConfig)
 
-				nextState = StateIdle
+			nextState = StateIdle
+		} else if opDone && opName != "NA" && status.RolloutPercentages != nil && status.RolloutPercentages[cfg] < 100.0 {
+			stepOp, err := advanceRollout(ctx, parent, status)
+			if err != nil {
+				status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutFailed", err.Error())
+				return status, &desiredChildren, recordPollFailure(ctx, status, currState, err)
+			}
+			if stepOp != "" {
+				status.ServiceRollout = stepOp
 			}
+		} else if opDone {
+			logger.WithField("config", cfg).Info("Service config rollout complete")
+			reportStaleConfigs(ctx, status)
+			status.setCondition(ConditionRolloutComplete, corev1.ConditionTrue, "RolloutComplete", cfg)
+			recordEvent(parent, corev1.EventTypeNormal, "RolloutComplete", "Rollout of config %s complete for endpoint %s", cfg, ep)
+			clearFailure(status)
+
+			nextState = StateIdle
 		}
 	}
 
 	// Advance the state
 	if status.StateCurrent != nextState {
-		log.Printf("[INFO][%s] Current state: %s", parent.Name, nextState)
+		logger.WithField("state", nextState).Info("State changed")
 	}
 	status.StateCurrent = nextState
 
 	return status, &desiredChildren, nil
 }
 
-func changeDetected(parent *CloudEndpoint, children *CloudEndpointControllerRequestChildren, status *CloudEndpointControllerStatus) bool {
+// recordFailure records the error and attempt count in status and schedules the next retry with exponential backoff.
+// After maxFailedAttempts consecutive failures the state is set to FAILED and no retry is scheduled.
+func recordFailure(ctx context.Context, parent *CloudEndpoint, status *CloudEndpointControllerStatus, err error) error {
+	logger := loggerFrom(ctx)
+	status.FailedAttempts++
+	status.LastError = err.Error()
+	status.LastAppliedSig = calcParentSig(parent, "")
+	status.BackoffState = ""
+
+	if status.FailedAttempts >= maxFailedAttempts {
+		logger.WithError(err).WithField("attempts", status.FailedAttempts).Error("Giving up after too many failed attempts")
+		status.NextRetryTime = nil
+		status.StateCurrent = StateFailed
+		return err
+	}
+
+	scheduleRetry(ctx, status)
+	return err
+}
+
+// recordPollFailure records an error of an API call made while waiting on the operation of the pending state.
+// The operation may still complete, so the state is resumed after the backoff and the retries never move to FAILED.
+func recordPollFailure(ctx context.Context, status *CloudEndpointControllerStatus, state string, err error) error {
+	status.FailedAttempts++
+	status.LastError = err.Error()
+	status.BackoffState = state
+	scheduleRetry(ctx, status)
+	return err
+}
+
+// scheduleRetry moves to BACKOFF with the next retry time doubling with every failed attempt.
+func scheduleRetry(ctx context.Context, status *CloudEndpointControllerStatus) {
+	delay := backoffMaxSeconds
+	if status.FailedAttempts < 32 && backoffBaseSeconds<<uint(status.FailedAttempts-1) < backoffMaxSeconds {
+		delay = backoffBaseSeconds << uint(status.FailedAttempts-1)
+	}
+	nextRetry := metav1.NewTime(time.Now().Add(time.Duration(delay) * time.Second))
+	status.NextRetryTime = &nextRetry
+	status.StateCurrent = StateBackoff
+	loggerFrom(ctx).WithFields(logrus.Fields{"state": StateBackoff, "retryIn": delay}).Info("State changed")
+}
+
+// clearFailure resets the failure tracking fields after a successful rollout.
+func clearFailure(status *CloudEndpointControllerStatus) {
+	status.FailedAttempts = 0
+	status.LastError = ""
+	status.NextRetryTime = nil
+}
+
+func changeDetected(ctx context.Context, parent *CloudEndpoint, children *CloudEndpointControllerRequestChildren, status *CloudEndpointControllerStatus) bool {
+	logger := loggerFrom(ctx)
 	changed := false
 
-	if status.StateCurrent == StateIdle {
+	if status.StateCurrent == StateIdle || status.StateCurrent == StateFailed {
 
 		// Changed if parent spec changes
 		if status.LastAppliedSig != calcParentSig(parent, "") {
-			log.Printf("[DEBUG][%s] Changed because parent sig different", parent.Name)
+			logger.Debug("Changed because parent sig different")
 			changed = true
 		}
 
-		// Changed if using target ingress and ingress IP changes.
-		if parent.Spec.TargetIngress.Name != "" {
-			// Fetch the ingress
-			ingress, err := config.clientset.ExtensionsV1beta1().Ingresses(parent.Spec.TargetIngress.Namespace).Get(parent.Spec.TargetIngress.Name, metav1.GetOptions{})
-			if err == nil {
-				// Compare ingress IP with configured IP
-				if len(ingress.Status.LoadBalancer.Ingress) > 0 && ingress.Status.LoadBalancer.Ingress[0].IP != status.IngressIP {
-					log.Printf("[DEBUG][%s] Changed because ingress target IP changed", parent.Name)
-					changed = true
-				}
+		// Changed if an aborted rollout is no longer aborted, the config is rolled out again.
+		if abortCleared(parent, status) {
+			logger.WithField("config", status.AbortedConfig).Debug("Changed because rollout abort was cleared")
+			changed = true
+		}
+
+		// Changed if using a static IP and the reserved address changes.
+		if parent.Spec.StaticIP != nil {
+			if status.StaticIP != nil && status.StaticIP.Address != "" && status.StaticIP.Address != status.IngressIP {
+				logger.WithFields(logrus.Fields{"target": status.StaticIP.Address, "previous": status.IngressIP}).Debug("Changed because static IP changed")
+				changed = true
+			}
+		} else if parent.Spec.TargetIngress.Name != "" || parent.Spec.TargetService != nil {
+			// Changed if using target ingress or service and the current target is no longer one of the load balancer addresses.
+			if targets := currentTargets(ctx, parent); len(targets) > 0 && containsString(targets, status.IngressIP) == false {
+				logger.WithFields(logrus.Fields{"targets": targets, "previous": status.IngressIP}).Debug("Changed because target IP changed")
+				changed = true
 			}
 		}
 
 		if parent.Spec.OpenAPISpecConfigMap.Name != "" {
 			specData, err := getConfigMapSpecData(parent.ObjectMeta.Namespace, parent.Spec.OpenAPISpecConfigMap.Name, parent.Spec.OpenAPISpecConfigMap.Key)
 			if err != nil || toSha1(specData) != status.ConfigMapHash {
-				log.Printf("[DEBUG][%s] Changed because configmap spec changed.", parent.Name)
+				logger.Debug("Changed because configmap spec changed")
+				changed = true
+			}
+		}
+
+		if len(parent.Spec.OpenAPISpecFrom) > 0 {
+			hash, err := openAPISourcesHash(parent.ObjectMeta.Namespace, parent.Spec.OpenAPISpecFrom)
+			if err != nil || hash != status.ConfigMapHash {
+				logger.Debug("Changed because openAPISpecFrom sources changed")
+				changed = true
+			}
+		}
+
+		if parent.Spec.Wildcard != nil && parent.Spec.Wildcard.PathsFromIngress && usesWildcardTemplate(parent) {
+			paths, err := ingressWildcardPaths(parent)
+			if err == nil && wildcardPathsHash(paths) != status.ConfigMapHash {
+				logger.Debug("Changed because ingress paths changed")
+				changed = true
+			}
+		}
+
+		if parent.Spec.GRPC != nil && parent.Spec.GRPC.hasExternalSources() {
+			descriptorSet, serviceConfigTemplate, err := getGRPCSources(parent.ObjectMeta.Namespace, parent.Spec.GRPC)
+			if err != nil || grpcSourceHash(descriptorSet, serviceConfigTemplate) != status.ConfigMapHash {
+				logger.Debug("Changed because gRPC descriptor set or service config changed")
 				changed = true
 			}
 		}
@@ -321,34 +863,54 @@ func changeDetected(parent *CloudEndpoint, children *CloudEndpointControllerRequ
 	return changed
 }
 
-func getTargetIngress(parent *CloudEndpoint) (string, []string, error) {
-	var target string
+// jwtBackendNotFoundError is returned when the backend service of a JWT service could not be found on the Ingress.
+type jwtBackendNotFoundError struct {
+	msg string
+}
+
+func (e jwtBackendNotFoundError) Error() string {
+	return e.msg
+}
+
+// getTargetIngress returns the load balancer addresses of the target ingress and the JWT audiences of its jwtServices, or no addresses while the load balancer is being provisioned.
+func getTargetIngress(ctx context.Context, parent *CloudEndpoint) ([]string, []string, error) {
+	logger := loggerFrom(ctx)
 	var jwtAudiences []string
 
-	ingress, err := config.clientset.ExtensionsV1beta1().Ingresses(parent.Spec.TargetIngress.Namespace).Get(parent.Spec.TargetIngress.Name, metav1.GetOptions{})
+	spec := targetIngressSpec(parent)
+	kind := targetIngressKind(spec)
+	if err := checkReference(parent, kind, spec.Namespace, spec.Name); err != nil {
+		return nil, nil, err
+	}
+	ingress, addresses, err := resolveTargetIngress(spec)
 	if err != nil {
-		log.Printf("[INFO][%s] waiting for Ingress %s", parent.Name, parent.Spec.TargetIngress.Name)
-		return "", nil, nil
+		return nil, nil, err
 	}
-	// Get target from ingress IP
-	if len(ingress.Status.LoadBalancer.Ingress) < 1 {
-		log.Printf("[INFO][%s] waiting for loadbalancer status from Ingress %s", parent.Name, parent.Spec.TargetIngress.Name)
-		return "", nil, nil
+	if ingress == nil {
+		logger.WithField("ingress", spec.Name).Infof("Waiting for %s", kind)
+		return nil, nil, nil
+	}
+	// Get targets from ingress status
+	if len(addresses) < 1 {
+		logger.WithField("ingress", spec.Name).Infof("Waiting for load balancer status from %s", kind)
+		return nil, nil, nil
 	}
-	target = ingress.Status.LoadBalancer.Ingress[0].IP
 
 	// Populate the jwtAudiences
-	if len(parent.Spec.TargetIngress.JWTServices) > 0 {
-		ingBackends, err := getIngBackends(ingress)
+	if len(spec.JWTServices) > 0 {
+		if kind != TargetKindIngress {
+			return nil, nil, fmt.Errorf("targetIngress.jwtServices is only supported with kind %s", TargetKindIngress)
+		}
+		ingBackends, err := getIngBackends(ctx, ingress.GetAnnotations())
 		if err != nil {
-			return "", nil, err
+			return nil, nil, err
 		}
-		bePatterns := make([]string, len(parent.Spec.TargetIngress.JWTServices))
+		bePatterns := make([]string, len(spec.JWTServices))
 
-		for i, svcName := range parent.Spec.TargetIngress.JWTServices {
-			svc, err := config.clientset.CoreV1().Services(parent.Spec.TargetIngress.Namespace).Get(svcName, metav1.GetOptions{})
+		for i, svcName := range spec.JWTServices {
+			svc, err := getService(spec.Namespace, svcName)
 			if err != nil {
-				return "", nil, fmt.Errorf("Failed to populate JWT audience from kubernetes service, not found: '%s', %v", svcName, err)
+				return nil, nil, fmt.Errorf("Failed to populate JWT audience from kubernetes service, not found: '%s', %v", svcName, err)
 			}
 			if svc.Spec.Type == corev1.ServiceTypeNodePort && len(svc.Spec.Ports) > 0 {
 				nodePort := strconv.Itoa(int(svc.Spec.Ports[0].NodePort))
@@ -356,31 +918,41 @@ func getTargetIngress(parent *CloudEndpoint) (string, []string, error) {
 				for _, be := range ingBackends {
 					if strings.Contains(be, fmt.Sprintf("k8s-be-%s", nodePort)) {
 						bePatterns[i] = be
-						backend, err := config.clientCompute.BackendServices.Get(config.Project, be).Do()
+						backend, err := config.clientCompute.GetBackendService(ctx, config.Project, be)
 						if err == nil {
 							found = true
 							jwtAud := makeJWTAudience(config.ProjectNum, strconv.Itoa(int(backend.Id)))
-							log.Printf("[INFO][%s] Created jwtAud: %s", parent.Name, jwtAud)
+							logger.WithField("jwtAudience", jwtAud).Info("Created JWT audience")
 							jwtAudiences = append(jwtAudiences, jwtAud)
 						}
 					}
 				}
 				if found == false {
-					return "", nil, fmt.Errorf("Backend not found or is not ready for service: %s, NodePort: %s", svcName, nodePort)
+					return nil, nil, jwtBackendNotFoundError{fmt.Sprintf("Backend not found or is not ready for service: %s, NodePort: %s", svcName, nodePort)}
 				}
 			} else {
-				return "", nil, fmt.Errorf("Service %s not type NodePort", svcName)
+				return nil, nil, fmt.Errorf("Service %s not type NodePort", svcName)
 			}
 		}
 	}
-	return target, jwtAudiences, nil
+	return addresses, jwtAudiences, nil
 }
 
 func calcParentSig(parent *CloudEndpoint, addStr string) string {
 	hasher := sha1.New()
-	data, err := json.Marshal(&parent.Spec)
+	spec := parent.Spec
+	if spec.Rollout != nil {
+		// Pausing or aborting a rollout should not trigger a new config submit, see abortCleared and the rollout pending state.
+		rollout := *spec.Rollout
+		rollout.Paused = false
+		rollout.Abort = false
+		spec.Rollout = &rollout
+	}
+	// The managed certificate is reconciled separately from the service config.
+	spec.ManagedCertificate = nil
+	data, err := json.Marshal(&spec)
 	if err != nil {
-		log.Printf("[ERROR][%s] Failed to convert parent spec to JSON, this is a bug.", parent.Name)
+		rootLogger.WithFields(logrus.Fields{"namespace": parent.Namespace, "name": parent.Name}).Error("Failed to convert parent spec to JSON, this is a bug")
 		return ""
 	}
 	hasher.Write([]byte(data))
@@ -388,13 +960,10 @@ func calcParentSig(parent *CloudEndpoint, addStr string) string {
 	return fmt.Sprintf("%x", hasher.Sum(nil))
 }
 
-func validateOpenAPISpec(specOriginal string) error {
-	var spec map[string]interface{}
-	return yaml.Unmarshal([]byte(specOriginal), &spec)
-}
-
-func getWildcardAPITemplate() string {
-	return `swagger: "2.0"
+// getWildcardAPITemplate returns the wildcard template with the methods on every path, and x-google-allow: all when allowAll is set.
+func getWildcardAPITemplate(paths []wildcardPath, methods []string, allowAll bool) string {
+	var b bytes.Buffer
+	b.WriteString(`swagger: "2.0"
 info:
   description: "wildcard config for any HTTP service."
   title: "General HTTP Service."
@@ -403,7 +972,11 @@ host: "{{ .Endpoint }}"
 x-google-endpoints:
 - name: "{{ .Endpoint }}"
   target: "{{ .Target }}"
-basePath: "/"
+`)
+	if allowAll {
+		b.WriteString("x-google-allow: all\n")
+	}
+	b.WriteString(`basePath: "/"
 consumes:
 - "application/json"
 produces:
@@ -412,72 +985,79 @@ schemes:
 - "http"
 - "https"
 paths:
-  "/**":
-    get:
-      operationId: Get
-      responses:
-        '200':
-          description: Get
-        default:
-          description: Error
-    delete:
-      operationId: Delete
-      responses:
-        '204':
-          description: Delete
-        default:
-          description: Error
-    patch:
-      operationId: Patch
-      responses:
-        '200':
-          description: Patch
-        default:
-          description: Error
-    post:
-      operationId: Post
-      responses:
-        '200':
-          description: Post
-        default:
-          description: Error
-    put:
-      operationId: Put
-      responses:
-        '200':
-          description: Put
-        default:
-          description: Error
-{{- if .JWTAudiences }}
-security:
-- google_jwt: []
-securityDefinitions:
-  google_jwt:
-    authorizationUrl: ""
-    flow: "implicit"
-    type: "oauth2"
-    x-google-issuer: "https://cloud.google.com/iap"
-    x-google-jwks_uri: "https://www.gstatic.com/iap/verify/public_key-jwk"
-    x-google-audiences: "{{ StringsJoin .JWTAudiences "," }}"
-{{ end }}
-`
+`)
+	operationIDs := make(map[string]bool)
+	for _, p := range paths {
+		fmt.Fprintf(&b, "  %s:\n", escapeTemplateText(fmt.Sprintf("%q", p.path)))
+		for _, method := range methods {
+			id := wildcardOperationID(method, p.path)
+			for i := 2; operationIDs[id]; i++ {
+				id = fmt.Sprintf("%s%d", wildcardOperationID(method, p.path), i)
+			}
+			operationIDs[id] = true
+			code := "200"
+			if method == "delete" {
+				code = "204"
+			}
+			fmt.Fprintf(&b, "    %s:\n      operationId: %s\n", method, id)
+			if p.backend != "" {
+				fmt.Fprintf(&b, "      description: %s\n", escapeTemplateText(fmt.Sprintf("%q", "Backend: "+p.backend)))
+			}
+			fmt.Fprintf(&b, "      responses:\n        '%s':\n          description: %s\n        default:\n          description: Error\n", code, strings.Title(method))
+		}
+	}
+	b.WriteString(`{{- if .Authentication }}
+{{ .Authentication }}
+{{- end }}
+`)
+	return b.String()
 }
 
-func executeTemplate(templateSpec, endpoint, target string, jwtAudiences []string) (string, error) {
-	t, err := template.New("openapi.yaml").Funcs(template.FuncMap{"StringsJoin": strings.Join}).Parse(templateSpec)
-	if err != nil {
-		return "", err
+// escapeTemplateText escapes the template delimiters in text written into a template, so it is rendered as is.
+func escapeTemplateText(s string) string {
+	return strings.Replace(s, "{{", `{{"{{"}}`, -1)
+}
+
+// openAPISpecTemplateData is the data of the OpenAPI spec and gRPC service config templates.
+type openAPISpecTemplateData struct {
+	Endpoint       string
+	Target         string
+	Targets        []string
+	TargetIPv4     string
+	TargetIPv6     string
+	TargetHostname string
+	JWTAudiences   []string
+	AuthProviders  []authProvider
+	Authentication template.HTML
+}
+
+func newTemplateData(endpoint, target string, targets []string, jwtAudiences []string, providers []authProvider) openAPISpecTemplateData {
+	data := openAPISpecTemplateData{
+		Endpoint:       endpoint,
+		Target:         target,
+		Targets:        targets,
+		JWTAudiences:   jwtAudiences,
+		AuthProviders:  providers,
+		Authentication: renderAuthentication(providers),
 	}
-	type openAPISpecTemplateData struct {
-		Endpoint     string
-		Target       string
-		JWTAudiences []string
+	for _, addr := range targets {
+		ip := net.ParseIP(addr)
+		switch {
+		case ip == nil && data.TargetHostname == "":
+			data.TargetHostname = addr
+		case ip != nil && ipFamily(ip) == AddressFamilyIPv4 && data.TargetIPv4 == "":
+			data.TargetIPv4 = addr
+		case ip != nil && ipFamily(ip) == AddressFamilyIPv6 && data.TargetIPv6 == "":
+			data.TargetIPv6 = addr
+		}
 	}
+	return data
+}
 
-	data := openAPISpecTemplateData{
-		Endpoint:     endpoint,
-		Target:       target,
-		JWTAudiences: jwtAudiences,
+func executeTemplate(templateSpec string, data openAPISpecTemplateData) (string, error) {
+	t, err := template.New("openapi.yaml").Funcs(template.FuncMap{"StringsJoin": strings.Join}).Parse(templateSpec)
+	if err != nil {
+		return "", err
 	}
 
 	var b bytes.Buffer
@@ -488,13 +1068,13 @@ func executeTemplate(templateSpec, endpoint, target string, jwtAudiences []strin
 	return b.String(), nil
 }
 
-func getIngBackends(ing *v1beta1.Ingress) ([]string, error) {
+func getIngBackends(ctx context.Context, annotations map[string]string) ([]string, error) {
 	backends := make([]string, 0)
 
-	if b, ok := ing.Annotations["ingress.kubernetes.io/backends"]; ok == true {
+	if b, ok := annotations["ingress.kubernetes.io/backends"]; ok == true {
 		var ingBackendsMap map[string]string
 		if err := json.Unmarshal([]byte(b), &ingBackendsMap); err != nil {
-			log.Printf("[WARN] Failed to parse ingress.kubernetes.io/backends annotation: %v", err)
+			loggerFrom(ctx).WithError(err).Warn("Failed to parse ingress.kubernetes.io/backends annotation")
 			return backends, nil
 		}
 		for bs := range ingBackendsMap {
@@ -516,7 +1096,9 @@ func toSha1(data string) string {
 }
 
 func getConfigMapSpecData(namespace string, name string, key string) (string, error) {
-	configMaps := config.clientset.CoreV1().ConfigMaps(namespace)
-	configMap, err := configMaps.Get(name, metav1.GetOptions{})
-	return configMap.Data[key], err
+	configMap, err := getConfigMap(namespace, name)
+	if err != nil {
+		return "", err
+	}
+	return configMap.Data[key], nil
 }
@@ -0,0 +1,533 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const (
+	testProject  = "test-project"
+	testEndpoint = "svc1.endpoints.test-project.cloud.goog"
+	testTarget   = "203.0.113.10"
+	// Name of the managed certificate and static IP created for the test CloudEndpoint.
+	testComputeName = "cloudep-default-svc1"
+)
+
+const testOpenAPISpec = `swagger: "2.0"
+info:
+  title: "Test API"
+  version: "1.0.0"
+host: "{{ .Endpoint }}"
+x-google-endpoints:
+- name: "{{ .Endpoint }}"
+  target: "{{ .Target }}"
+paths:
+  /users:
+    get:
+      operationId: ListUsers
+      responses:
+        '200':
+          description: OK
+`
+
+// testEnv holds the fakes set in the global config for one test case.
+type testEnv struct {
+	sm        *fakeServiceManager
+	compute   *fakeCompute
+	clientset *fake.Clientset
+}
+
+// newTestEnv sets the global config to fake clients with the given core objects and target ingresses.
+// Discovery serves networking.k8s.io/v1 Ingresses and gateway.networking.k8s.io/v1 Gateways.
+func newTestEnv(objects []runtime.Object, targets []runtime.Object) *testEnv {
+	env := &testEnv{
+		sm:        newFakeServiceManager(0),
+		compute:   newFakeCompute(),
+		clientset: fake.NewSimpleClientset(objects...),
+	}
+	env.clientset.Resources = []*metav1.APIResourceList{
+		{GroupVersion: "networking.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "ingresses", Namespaced: true, Kind: "Ingress"}}},
+		{GroupVersion: "gateway.networking.k8s.io/v1", APIResources: []metav1.APIResource{{Name: "gateways", Namespaced: true, Kind: "Gateway"}}},
+	}
+	config = Config{
+		Project:          testProject,
+		ProjectNum:       "123456789",
+		clientServiceMan: env.sm,
+		clientCompute:    env.compute,
+		clientset:        env.clientset,
+		dynamicClient:    dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), targets...),
+	}
+	return env
+}
+
+func newTestParent() *CloudEndpoint {
+	return &CloudEndpoint{
+		ObjectMeta: metav1.ObjectMeta{Name: "svc1", Namespace: "default", UID: "uid-svc1", Generation: 1},
+		Spec: CloudEndpointSpec{
+			Project: testProject,
+			Target:  testTarget,
+		},
+	}
+}
+
+// runSyncs calls sync n times, feeding the returned status back into the parent like metacontroller does.
+// Only the last sync may return an error.
+func runSyncs(t *testing.T, parent *CloudEndpoint, n int) (*CloudEndpointControllerStatus, error) {
+	var status *CloudEndpointControllerStatus
+	var err error
+	for i := 0; i < n; i++ {
+		if err != nil {
+			t.Fatalf("sync %d returned error: %v", i, err)
+		}
+		status, _, err = sync(context.Background(), parent, &CloudEndpointControllerRequestChildren{})
+		parent.Status = *status
+	}
+	return status, err
+}
+
+// checkConditions fails the test unless every condition type has the given reason.
+func checkConditions(t *testing.T, status *CloudEndpointControllerStatus, reasons map[CloudEndpointConditionType]string) {
+	t.Helper()
+	for condType, reason := range reasons {
+		cond := status.getCondition(condType)
+		if cond == nil {
+			t.Errorf("condition %s not set, want reason %s", condType, reason)
+			continue
+		}
+		if cond.Reason != reason {
+			t.Errorf("condition %s reason = %s, want %s, message: %s", condType, cond.Reason, reason, cond.Message)
+		}
+	}
+}
+
+// submittedFiles returns the decoded contents of the files of the nth submitted config.
+func submittedFiles(t *testing.T, env *testEnv, n int) []string {
+	t.Helper()
+	if len(env.sm.submitted) <= n {
+		t.Fatalf("%d configs submitted, want more than %d", len(env.sm.submitted), n)
+	}
+	files := make([]string, 0)
+	for _, f := range env.sm.submitted[n].Files {
+		data, err := base64.StdEncoding.DecodeString(f.FileContents)
+		if err != nil {
+			t.Fatalf("failed to decode config file %s: %v", f.FilePath, err)
+		}
+		files = append(files, string(data))
+	}
+	return files
+}
+
+func seedService(env *testEnv) {
+	env.sm.services[testEndpoint] = &servicemanagement.ManagedService{ServiceName: testEndpoint, ProducerProjectId: testProject}
+}
+
+// seedServingConfig adds a config that serves all traffic, so that the next rollout has a previous config.
+func seedServingConfig(env *testEnv) {
+	seedService(env)
+	env.sm.configs[testEndpoint] = []*servicemanagement.Service{{Id: "2018-01-01r0", Name: testEndpoint}}
+	env.sm.rollouts[testEndpoint] = []*servicemanagement.Rollout{{
+		RolloutId:              "2018-01-01r0",
+		ServiceName:            testEndpoint,
+		Status:                 "SUCCESS",
+		TrafficPercentStrategy: &servicemanagement.TrafficPercentStrategy{Percentages: map[string]float64{"2018-01-01r0": 100.0}},
+	}}
+}
+
+func testLoadBalancerService(name string, ips ...string) *corev1.Service {
+	svc := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: corev1.ServiceSpec{
+			Type:  corev1.ServiceTypeLoadBalancer,
+			Ports: []corev1.ServicePort{{Port: 80}},
+		},
+	}
+	for _, ip := range ips {
+		svc.Status.LoadBalancer.Ingress = append(svc.Status.LoadBalancer.Ingress, corev1.LoadBalancerIngress{IP: ip})
+	}
+	return svc
+}
+
+// testIngress returns a networking.k8s.io/v1 Ingress with the load balancer IPs and a rule with the given paths.
+func testIngress(namespace, name string, ips []string, paths ...interface{}) *unstructured.Unstructured {
+	lbIngress := make([]interface{}, 0)
+	for _, ip := range ips {
+		lbIngress = append(lbIngress, map[string]interface{}{"ip": ip})
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"spec": map[string]interface{}{
+			"rules": []interface{}{
+				map[string]interface{}{"http": map[string]interface{}{"paths": paths}},
+			},
+		},
+		"status": map[string]interface{}{
+			"loadBalancer": map[string]interface{}{"ingress": lbIngress},
+		},
+	}}
+}
+
+func testIngressPath(p, pathType, backend string) map[string]interface{} {
+	return map[string]interface{}{
+		"path":     p,
+		"pathType": pathType,
+		"backend":  map[string]interface{}{"service": map[string]interface{}{"name": backend}},
+	}
+}
+
+func testNamespace(name string, annotations map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Annotations: annotations}}
+}
+
+// syncTest is a sync transition case, spec and setup prepare the parent and the fakes before syncs calls to sync.
+type syncTest struct {
+	name    string
+	spec    func(parent *CloudEndpoint)
+	objects []runtime.Object
+	targets []runtime.Object
+	setup   func(env *testEnv, parent *CloudEndpoint)
+	syncs   int
+	// update is applied to the parent after syncs, followed by resyncs more syncs.
+	update     func(parent *CloudEndpoint)
+	resyncs    int
+	wantErr    bool
+	state      string
+	conditions map[CloudEndpointConditionType]string
+	check      func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus)
+}
+
+// runSyncTests runs every case against a new test environment and parent.
+func runSyncTests(t *testing.T, tests []syncTest) {
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			env := newTestEnv(tc.objects, tc.targets)
+			parent := newTestParent()
+			if tc.spec != nil {
+				tc.spec(parent)
+			}
+			if tc.setup != nil {
+				tc.setup(env, parent)
+			}
+
+			status, err := runSyncs(t, parent, tc.syncs)
+			if tc.update != nil {
+				if err != nil {
+					t.Fatalf("sync returned error before update: %v", err)
+				}
+				tc.update(parent)
+				status, err = runSyncs(t, parent, tc.resyncs)
+			}
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("sync error = %v, wantErr %v", err, tc.wantErr)
+			}
+			if status.StateCurrent != tc.state {
+				t.Errorf("state = %s, want %s, lastError: %s", status.StateCurrent, tc.state, status.LastError)
+			}
+			checkConditions(t, status, tc.conditions)
+			if tc.check != nil {
+				tc.check(t, env, status)
+			}
+		})
+	}
+}
+
+func TestSync(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name:       "new endpoint creates the service",
+			syncs:      1,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionConfigSubmitted: "Pending"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok == false {
+					t.Errorf("service %s not created", testEndpoint)
+				}
+			},
+		},
+		{
+			name:       "config is submitted once the service exists",
+			syncs:      2,
+			state:      StateEndpointSubmitPending,
+			conditions: map[CloudEndpointConditionType]string{ConditionServiceCreated: "ServiceExists", ConditionSpecValid: "Valid", ConditionConfigSubmitted: "SubmitPending", ConditionTargetResolved: "TargetResolved"},
+		},
+		{
+			name:       "submit pending while the operation runs",
+			setup:      func(env *testEnv, parent *CloudEndpoint) { env.sm.opSteps = 3 },
+			syncs:      3,
+			state:      StateEndpointSubmitPending,
+			conditions: map[CloudEndpointConditionType]string{ConditionConfigSubmitted: "SubmitPending"},
+		},
+		{
+			name:       "rollout is created after the submit completes",
+			syncs:      3,
+			state:      StateEndpointRolloutPending,
+			conditions: map[CloudEndpointConditionType]string{ConditionConfigSubmitted: "ConfigSubmitted", ConditionRolloutComplete: "RolloutPending"},
+		},
+		{
+			name:       "rollout completes",
+			syncs:      4,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutComplete", ConditionReady: "RolloutComplete"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Config != "2018-01-01r0" || status.IngressIP != testTarget || status.Endpoint != testEndpoint {
+					t.Errorf("status config = %s, ingressIP = %s, endpoint = %s", status.Config, status.IngressIP, status.Endpoint)
+				}
+			},
+		},
+		{
+			name:  "idle endpoint without changes stays idle",
+			syncs: 6,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if n := len(env.sm.submitted); n != 1 {
+					t.Errorf("%d configs submitted, want 1", n)
+				}
+			},
+		},
+		{
+			name:    "spec change submits a new config",
+			syncs:   4,
+			update:  func(parent *CloudEndpoint) { parent.Spec.Target = "203.0.113.11" },
+			resyncs: 4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Config != "2018-01-01r1" || status.IngressIP != "203.0.113.11" {
+					t.Errorf("status config = %s, ingressIP = %s, want 2018-01-01r1, 203.0.113.11", status.Config, status.IngressIP)
+				}
+			},
+		},
+	})
+}
+
+func TestSyncServiceCreate(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "soft deleted service is undeleted",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.deleted[testEndpoint] = &servicemanagement.ManagedService{ServiceName: testEndpoint}
+			},
+			syncs: 1,
+			state: StateEndpointCreatePending,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok == false {
+					t.Errorf("service %s not undeleted", testEndpoint)
+				}
+			},
+		},
+		{
+			name: "service that already exists is a create error",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["GetService"] = &googleapi.Error{Code: http.StatusForbidden, Message: "not found or permission denied"}
+				seedService(env)
+			},
+			syncs:      1,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionServiceCreated: "CreateFailed"},
+		},
+	})
+}
+
+func TestSyncBackoff(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "service create error backs off",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["CreateService"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			syncs:      1,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionServiceCreated: "CreateFailed", ConditionReady: "Backoff"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.FailedAttempts != 1 || status.NextRetryTime == nil || status.LastError == "" {
+					t.Errorf("failedAttempts = %d, nextRetryTime = %v, lastError = %s", status.FailedAttempts, status.NextRetryTime, status.LastError)
+				}
+			},
+		},
+		{
+			name: "service lookup error backs off",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["GetService"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			syncs:      1,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionServiceCreated: "GetFailed"},
+		},
+		{
+			name: "submit error backs off",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["SubmitConfig"] = &googleapi.Error{Code: http.StatusBadRequest, Message: "bad config"}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionConfigSubmitted: "SubmitFailed"},
+		},
+		{
+			name: "submit operation poll error keeps the pending submit",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.errors["GetOperation"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			syncs:   3,
+			wantErr: true,
+			state:   StateBackoff,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.BackoffState != StateEndpointSubmitPending || status.ConfigSubmit == "" {
+					t.Errorf("backoffState = %s, configSubmit = %s, want the pending submit", status.BackoffState, status.ConfigSubmit)
+				}
+			},
+		},
+		{
+			name: "backoff after a poll error resumes the pending submit",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				seedService(env)
+				env.sm.configs[testEndpoint] = []*servicemanagement.Service{{Id: "2018-01-01r0", Name: testEndpoint}}
+				op := env.sm.startOperation("SubmitConfig", &servicemanagement.SubmitConfigSourceResponse{ServiceConfig: &servicemanagement.Service{Id: "2018-01-01r0"}}, nil)
+				retry := metav1.NewTime(time.Now().Add(-time.Second))
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateBackoff, BackoffState: StateEndpointSubmitPending, Endpoint: testEndpoint, ConfigSubmit: op.Name, FailedAttempts: 1, NextRetryTime: &retry, LastAppliedSig: calcParentSig(parent, "")}
+			},
+			syncs: 2,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(env.sm.submitted) != 0 || status.Config != "2018-01-01r0" || status.FailedAttempts != 0 {
+					t.Errorf("%d configs submitted, config = %s, failedAttempts = %d", len(env.sm.submitted), status.Config, status.FailedAttempts)
+				}
+			},
+		},
+		{
+			name: "spec change during a poll backoff keeps the pending submit",
+			spec: func(parent *CloudEndpoint) { parent.Spec.Target = "203.0.113.11" },
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				retry := metav1.NewTime(time.Now().Add(time.Hour))
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateBackoff, BackoffState: StateEndpointSubmitPending, Endpoint: testEndpoint, ConfigSubmit: "operations/submit", FailedAttempts: 1, NextRetryTime: &retry, LastAppliedSig: "previous"}
+			},
+			syncs: 1,
+			state: StateBackoff,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.BackoffState != StateEndpointSubmitPending || status.ConfigSubmit != "operations/submit" {
+					t.Errorf("backoffState = %s, configSubmit = %s, want the pending submit", status.BackoffState, status.ConfigSubmit)
+				}
+			},
+		},
+		{
+			name:  "rollout operation poll error keeps the pending rollout",
+			syncs: 3,
+			update: func(parent *CloudEndpoint) {
+				config.clientServiceMan.(*fakeServiceManager).errors["GetOperation"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			resyncs: 1,
+			wantErr: true,
+			state:   StateBackoff,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.BackoffState != StateEndpointRolloutPending || status.ServiceRollout == "" || status.ServiceRollout == "NA" {
+					t.Errorf("backoffState = %s, serviceRollout = %s, want the pending rollout", status.BackoffState, status.ServiceRollout)
+				}
+			},
+		},
+		{
+			name: "failed submit operation backs off",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.opErrors["SubmitConfig"] = &servicemanagement.Status{Message: "invalid config"}
+			},
+			syncs:      3,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionConfigSubmitted: "SubmitFailed"},
+		},
+		{
+			name: "failed rollout operation backs off",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.opErrors["CreateRollout"] = &servicemanagement.Status{Message: "rollout failed"}
+			},
+			syncs:      4,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutFailed"},
+		},
+		{
+			name: "backoff waits for the retry time",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				retry := metav1.NewTime(time.Now().Add(time.Hour))
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateBackoff, FailedAttempts: 1, NextRetryTime: &retry, LastAppliedSig: calcParentSig(parent, "")}
+			},
+			syncs: 1,
+			state: StateBackoff,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(env.sm.services) != 0 {
+					t.Errorf("service created before the retry time")
+				}
+			},
+		},
+		{
+			name: "backoff retries after the retry time",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				retry := metav1.NewTime(time.Now().Add(-time.Second))
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateBackoff, FailedAttempts: 1, NextRetryTime: &retry, LastAppliedSig: calcParentSig(parent, "")}
+			},
+			syncs: 1,
+			state: StateEndpointCreatePending,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.FailedAttempts != 1 {
+					t.Errorf("failedAttempts = %d, want 1 until the rollout completes", status.FailedAttempts)
+				}
+			},
+		},
+		{
+			name: "last attempt moves to failed",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				retry := metav1.NewTime(time.Now().Add(-time.Second))
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateBackoff, FailedAttempts: maxFailedAttempts - 1, NextRetryTime: &retry, LastAppliedSig: calcParentSig(parent, "")}
+				env.sm.errors["CreateService"] = &googleapi.Error{Code: http.StatusInternalServerError, Message: "backend error"}
+			},
+			syncs:   1,
+			wantErr: true,
+			state:   StateFailed,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.NextRetryTime != nil {
+					t.Errorf("nextRetryTime = %v, want nil", status.NextRetryTime)
+				}
+			},
+		},
+		{
+			name: "failed endpoint waits for a change",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateFailed, FailedAttempts: maxFailedAttempts, LastAppliedSig: calcParentSig(parent, "")}
+			},
+			syncs: 2,
+			state: StateFailed,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(env.sm.services) != 0 {
+					t.Errorf("service created without a change")
+				}
+			},
+		},
+		{
+			name: "failed endpoint restarts on a spec change",
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateFailed, FailedAttempts: maxFailedAttempts, LastAppliedSig: "previous"}
+			},
+			syncs: 1,
+			state: StateEndpointCreatePending,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.FailedAttempts != 0 {
+					t.Errorf("failedAttempts = %d, want 0", status.FailedAttempts)
+				}
+			},
+		},
+	})
+}
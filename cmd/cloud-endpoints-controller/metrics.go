@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	gosync "sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/api/googleapi"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var (
+	metricSyncDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "cloud_endpoints_controller_sync_duration_seconds",
+		Help: "Duration of sync and finalize hook calls.",
+	}, []string{"hook"})
+
+	metricSyncErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_endpoints_controller_sync_errors_total",
+		Help: "Number of sync calls that returned an error, by CloudEndpoint and condition reason.",
+	}, []string{"namespace", "name", "reason"})
+
+	metricStateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "cloud_endpoints_controller_state_duration_seconds",
+		Help:    "Time spent in a controller state before transitioning to the next state.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 14),
+	}, []string{"state"})
+
+	metricAPICalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "cloud_endpoints_controller_api_calls_total",
+		Help: "Number of Google Cloud API calls by API, method and HTTP status code.",
+	}, []string{"api", "method", "code"})
+
+	metricEndpoints = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "cloud_endpoints_controller_cloudendpoints",
+		Help: "Number of CloudEndpoints in each controller state.",
+	}, []string{"state"})
+
+	metricLeader = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "cloud_endpoints_controller_leader",
+		Help: "1 if this replica is the active leader, 0 otherwise.",
+	})
+)
+
+// syncErrorReasons are the condition reasons of sync errors used as the reason label of metricSyncErrors.
+// Any other reason is counted as Unknown so that the number of series per CloudEndpoint stays bounded.
+var syncErrorReasons = []string{
+	"CreateFailed",
+	"GetFailed",
+	"UndeleteFailed",
+	"InvalidAddressFamily",
+	"TargetIngressError",
+	"JWTBackendNotFound",
+	"TargetServiceError",
+	"InvalidSpec",
+	"TemplateError",
+	"SpecSourceError",
+	"ServerValidationFailed",
+	"SubmitFailed",
+	"PinnedConfigNotFound",
+	"RolloutFailed",
+	"Unknown",
+}
+
+var allStates = []string{
+	StateIdle,
+	StateEndpointCreatePending,
+	StateEndpointValidatePending,
+	StateEndpointSubmitPending,
+	StateEndpointRolloutPending,
+	StateEndpointDeletePending,
+	StateBackoff,
+	StateFailed,
+}
+
+func init() {
+	prometheus.MustRegister(metricSyncDuration, metricSyncErrors, metricStateDuration, metricAPICalls, metricEndpoints, metricLeader)
+}
+
+// endpointStates tracks the last known state of every CloudEndpoint for the metricEndpoints gauge.
+var endpointStates = struct {
+	gosync.Mutex
+	states map[string]string
+}{states: make(map[string]string)}
+
+func endpointKey(parent *CloudEndpoint) string {
+	return parent.Namespace + "/" + parent.Name
+}
+
+// recordEndpointState updates the state of the CloudEndpoint and recomputes the per state gauge.
+func recordEndpointState(parent *CloudEndpoint, state string) {
+	endpointStates.Lock()
+	defer endpointStates.Unlock()
+	endpointStates.states[endpointKey(parent)] = state
+	updateEndpointsGauge()
+}
+
+// forgetEndpoint removes a finalized CloudEndpoint from the per state gauge and deletes its sync error series.
+func forgetEndpoint(parent *CloudEndpoint) {
+	endpointStates.Lock()
+	defer endpointStates.Unlock()
+	delete(endpointStates.states, endpointKey(parent))
+	updateEndpointsGauge()
+	for _, reason := range syncErrorReasons {
+		metricSyncErrors.DeleteLabelValues(parent.Namespace, parent.Name, reason)
+	}
+}
+
+func updateEndpointsGauge() {
+	counts := make(map[string]int)
+	for _, state := range endpointStates.states {
+		counts[state]++
+	}
+	for _, state := range allStates {
+		metricEndpoints.WithLabelValues(state).Set(float64(counts[state]))
+	}
+}
+
+// observeSync records the sync duration, errors and state transitions of a sync call.
+func observeSync(hook string, start time.Time, parent *CloudEndpoint, status *CloudEndpointControllerStatus, err error) {
+	metricSyncDuration.WithLabelValues(hook).Observe(time.Since(start).Seconds())
+
+	if err != nil {
+		metricSyncErrors.WithLabelValues(parent.Namespace, parent.Name, syncErrorReason(status.lastReason)).Inc()
+	}
+
+	prevState := parent.Status.StateCurrent
+	if prevState == "" {
+		prevState = StateIdle
+	}
+	if status.StateCurrent != prevState {
+		if status.StateTransitionTime != nil {
+			metricStateDuration.WithLabelValues(prevState).Observe(time.Since(status.StateTransitionTime.Time).Seconds())
+		}
+		now := metav1.Now()
+		status.StateTransitionTime = &now
+	}
+
+	recordEndpointState(parent, status.StateCurrent)
+}
+
+// syncErrorReason returns the reason label of metricSyncErrors for the condition reason.
+func syncErrorReason(reason string) string {
+	if containsString(syncErrorReasons, reason) {
+		return reason
+	}
+	return "Unknown"
+}
+
+// observeAPICall counts a Google Cloud API call by the HTTP status code of the result and logs it with the sync logger from the context.
+func observeAPICall(ctx context.Context, api, method string, err error) {
+	code := strconv.Itoa(http.StatusOK)
+	if err != nil {
+		code = "error"
+		if gerr, ok := err.(*googleapi.Error); ok {
+			code = strconv.Itoa(gerr.Code)
+		}
+	}
+	metricAPICalls.WithLabelValues(api, method, code).Inc()
+
+	logger := loggerFrom(ctx).WithFields(logrus.Fields{"api": api, "method": method, "code": code})
+	if err != nil {
+		logger.WithError(err).Warn("API call failed")
+		return
+	}
+	logger.Debug("API call")
+}
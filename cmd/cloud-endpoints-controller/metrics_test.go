@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// countSeries returns the number of series currently exported by the collector.
+func countSeries(c prometheus.Collector) int {
+	ch := make(chan prometheus.Metric, 1024)
+	c.Collect(ch)
+	close(ch)
+	return len(ch)
+}
+
+func TestSyncErrorReason(t *testing.T) {
+	for reason, want := range map[string]string{
+		"SubmitFailed":  "SubmitFailed",
+		"InvalidSpec":   "InvalidSpec",
+		"SubmitPending": "Unknown",
+		"":              "Unknown",
+	} {
+		if got := syncErrorReason(reason); got != want {
+			t.Errorf("syncErrorReason(%s) = %s, want %s", reason, got, want)
+		}
+	}
+}
+
+func TestForgetEndpoint(t *testing.T) {
+	parent := &CloudEndpoint{ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "default"}}
+	before := countSeries(metricSyncErrors)
+
+	for _, reason := range []string{"SubmitFailed", "SubmitFailed", "RolloutFailed", "SomethingElse", "AnotherReason"} {
+		observeSync("sync", time.Now(), parent, &CloudEndpointControllerStatus{StateCurrent: StateBackoff, lastReason: reason}, fmt.Errorf("failed"))
+	}
+	if n := countSeries(metricSyncErrors) - before; n != 3 {
+		t.Errorf("%d sync error series added, want 3", n)
+	}
+
+	forgetEndpoint(parent)
+	if n := countSeries(metricSyncErrors); n != before {
+		t.Errorf("%d sync error series after forgetEndpoint, want %d", n, before)
+	}
+}
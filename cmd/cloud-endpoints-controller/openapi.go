@@ -0,0 +1,219 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	gosync "sync"
+	"time"
+)
+
+const (
+	// Maximum size of an OpenAPI spec downloaded from a URL.
+	openAPISpecMaxBytes = 10 << 20
+	// Time an unpinned URL source is cached before it is downloaded again for change detection.
+	openAPISpecURLCacheTTL = time.Minute
+)
+
+var openAPISpecHTTPClient = &http.Client{Timeout: 30 * time.Second, CheckRedirect: checkOpenAPISpecRedirect}
+
+// checkOpenAPISpecRedirect follows a redirect only if the target is also in the --openapi-url-allowlist.
+func checkOpenAPISpecRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if openAPIURLAllowed(req.URL, config.OpenAPIURLAllowlist) == false {
+		return fmt.Errorf("redirect to '%s' is not in the --openapi-url-allowlist", req.URL)
+	}
+	return nil
+}
+
+// openAPISpecURLCache holds the last download of every unpinned URL source so that change detection does not download it on every resync.
+var openAPISpecURLCache = struct {
+	gosync.Mutex
+	entries map[string]openAPISpecURLCacheEntry
+}{entries: make(map[string]openAPISpecURLCacheEntry)}
+
+type openAPISpecURLCacheEntry struct {
+	data      string
+	fetchTime time.Time
+}
+
+// openAPISpecFile is the unrendered contents of one OpenAPI spec source and the file path it is submitted as.
+type openAPISpecFile struct {
+	path     string
+	contents string
+}
+
+// getOpenAPISpecSources reads all the openAPISpecFrom sources in order.
+// A ConfigMap or Secret that does not exist yet returns a sourceNotFoundError.
+func getOpenAPISpecSources(namespace string, sources []CloudEndpointOpenAPISpecSource) ([]openAPISpecFile, error) {
+	files := make([]openAPISpecFile, 0, len(sources))
+	paths := make(map[string]bool)
+	for i, src := range sources {
+		var filePath, contents string
+		switch {
+		case src.ConfigMap != nil && src.Secret == nil && src.URL == "":
+			name, key := src.ConfigMap.Name, src.ConfigMap.Key
+			data, err := getConfigMapSpecData(namespace, name, key)
+			if err != nil || data == "" {
+				return nil, sourceNotFoundError{fmt.Sprintf("Waiting for ConfigMap with OpenAPI spec named '%s' containing key: '%s'", name, key)}
+			}
+			filePath, contents = key, data
+		case src.Secret != nil && src.ConfigMap == nil && src.URL == "":
+			name, key := src.Secret.Name, src.Secret.Key
+			data, err := getSecretData(namespace, name, key)
+			if err != nil || len(data) == 0 {
+				return nil, sourceNotFoundError{fmt.Sprintf("Waiting for Secret with OpenAPI spec named '%s' containing key: '%s'", name, key)}
+			}
+			filePath, contents = key, string(data)
+		case src.URL != "" && src.ConfigMap == nil && src.Secret == nil:
+			data, err := getOpenAPISpecURL(src.URL, src.SHA256)
+			if err != nil {
+				return nil, err
+			}
+			u, _ := url.Parse(src.URL)
+			filePath, contents = path.Base(u.Path), data
+		default:
+			return nil, fmt.Errorf("openAPISpecFrom[%d] must set exactly one of configMap, secret or url", i)
+		}
+		if filePath == "" || filePath == "/" || filePath == "." || paths[filePath] {
+			filePath = fmt.Sprintf("openapi-%d.yaml", i)
+		}
+		paths[filePath] = true
+		files = append(files, openAPISpecFile{path: filePath, contents: contents})
+	}
+	return files, nil
+}
+
+// getOpenAPISpecURL downloads the spec from the URL and verifies the SHA256 checksum if one is given.
+// Plain http URLs must be pinned and all URLs, including redirects, must match the --openapi-url-allowlist.
+// Unpinned URLs are served from the cache for openAPISpecURLCacheTTL.
+func getOpenAPISpecURL(specURL, checksum string) (string, error) {
+	u, err := url.Parse(specURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("Invalid OpenAPI spec URL, must be http or https: '%s'", specURL)
+	}
+	if u.Scheme == "http" && checksum == "" {
+		return "", fmt.Errorf("OpenAPI spec URL '%s' uses http and must be pinned with sha256", specURL)
+	}
+	if strings.TrimSpace(config.OpenAPIURLAllowlist) == "" {
+		return "", fmt.Errorf("OpenAPI spec URL sources are disabled, set --openapi-url-allowlist to download '%s'", specURL)
+	}
+	if openAPIURLAllowed(u, config.OpenAPIURLAllowlist) == false {
+		return "", fmt.Errorf("OpenAPI spec URL '%s' is not in the --openapi-url-allowlist", specURL)
+	}
+
+	if checksum == "" {
+		openAPISpecURLCache.Lock()
+		entry, ok := openAPISpecURLCache.entries[specURL]
+		openAPISpecURLCache.Unlock()
+		if ok == true && time.Since(entry.fetchTime) < openAPISpecURLCacheTTL {
+			return entry.data, nil
+		}
+	}
+
+	resp, err := openAPISpecHTTPClient.Get(specURL)
+	if err != nil {
+		return "", fmt.Errorf("Failed to download OpenAPI spec from '%s': %v", specURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Failed to download OpenAPI spec from '%s': HTTP %d", specURL, resp.StatusCode)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, openAPISpecMaxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("Failed to download OpenAPI spec from '%s': %v", specURL, err)
+	}
+	if len(body) > openAPISpecMaxBytes {
+		return "", fmt.Errorf("OpenAPI spec from '%s' is larger than %d bytes", specURL, openAPISpecMaxBytes)
+	}
+
+	if checksum != "" {
+		sum := sha256.Sum256(body)
+		if actual := hex.EncodeToString(sum[:]); strings.EqualFold(actual, checksum) == false {
+			return "", fmt.Errorf("Checksum mismatch for OpenAPI spec from '%s': expected sha256 %s, got %s", specURL, checksum, actual)
+		}
+	}
+
+	openAPISpecURLCache.Lock()
+	openAPISpecURLCache.entries[specURL] = openAPISpecURLCacheEntry{data: string(body), fetchTime: time.Now()}
+	openAPISpecURLCache.Unlock()
+
+	return string(body), nil
+}
+
+// openAPIURLAllowed returns true if the URL matches one of the allowlist entries, an empty allowlist allows no URL.
+// An entry without a scheme matches the host, an entry with a scheme matches the scheme, host and the whole path segments of its path.
+func openAPIURLAllowed(u *url.URL, allowlist string) bool {
+	for _, entry := range strings.Split(allowlist, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "://") == false {
+			if strings.EqualFold(u.Host, entry) {
+				return true
+			}
+			continue
+		}
+		prefix, err := url.Parse(entry)
+		if err != nil {
+			continue
+		}
+		if strings.EqualFold(u.Scheme, prefix.Scheme) && strings.EqualFold(u.Host, prefix.Host) && pathHasPrefix(path.Clean("/"+u.Path), prefix.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathHasPrefix returns true if the cleaned path is the prefix or below it, so that /specs does not match /specs-private.
+func pathHasPrefix(p, prefix string) bool {
+	prefix = strings.TrimSuffix(path.Clean("/"+prefix), "/")
+	return prefix == "" || p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// openAPISourcesHash hashes the paths and contents of all the sources, used for change detection like ConfigMapHash.
+// Pinned URL sources contribute their checksum so they are not downloaded on every resync.
+func openAPISourcesHash(namespace string, sources []CloudEndpointOpenAPISpecSource) (string, error) {
+	pinned := make([]CloudEndpointOpenAPISpecSource, 0)
+	unpinned := make([]CloudEndpointOpenAPISpecSource, 0)
+	for _, src := range sources {
+		if src.URL != "" && src.SHA256 != "" {
+			pinned = append(pinned, src)
+			continue
+		}
+		unpinned = append(unpinned, src)
+	}
+	files, err := getOpenAPISpecSources(namespace, unpinned)
+	if err != nil {
+		return "", err
+	}
+	return openAPISpecFilesHash(files, pinned), nil
+}
+
+func openAPISpecFilesHash(files []openAPISpecFile, pinned []CloudEndpointOpenAPISpecSource) string {
+	h := sha256.New()
+	for _, f := range files {
+		fmt.Fprintf(h, "%s\x00%d\x00%s\x00", f.path, len(f.contents), f.contents)
+	}
+	for _, src := range pinned {
+		fmt.Fprintf(h, "%s\x00%s\x00", src.URL, strings.ToLower(src.SHA256))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// openAPIFileType returns the Service Management file type for the path of the spec.
+func openAPIFileType(filePath string) string {
+	if strings.HasSuffix(strings.ToLower(filePath), ".json") {
+		return "OPEN_API_JSON"
+	}
+	return "OPEN_API_YAML"
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSyncOpenAPISpecFrom(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "OpenAPI spec from a ConfigMap and a Secret",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.OpenAPISpecFrom = []CloudEndpointOpenAPISpecSource{
+					{ConfigMap: &CloudEndpointConfigMapSpec{Name: "specs", Key: "users.yaml"}},
+					{Secret: &CloudEndpointSecretSpec{Name: "internal-specs", Key: "internal.yaml"}},
+				}
+			},
+			objects: []runtime.Object{
+				&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "specs", Namespace: "default"}, Data: map[string]string{"users.yaml": testOpenAPISpec}},
+				&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "internal-specs", Namespace: "default"}, Data: map[string][]byte{"internal.yaml": []byte(strings.Replace(testOpenAPISpec, "ListUsers", "ListInternalUsers", 1))}},
+			},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if files := submittedFiles(t, env, 0); len(files) != 2 || strings.Contains(files[0], testTarget) == false {
+					t.Errorf("submitted files = %v", files)
+				}
+			},
+		},
+		{
+			name: "missing OpenAPI spec ConfigMap waits",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.OpenAPISpecFrom = []CloudEndpointOpenAPISpecSource{{ConfigMap: &CloudEndpointConfigMapSpec{Name: "specs", Key: "users.yaml"}}}
+			},
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "WaitingForSpecSource"},
+		},
+		{
+			name: "unpinned http OpenAPI spec URL backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.OpenAPISpecFrom = []CloudEndpointOpenAPISpecSource{{URL: "http://specs.example.com/users.yaml"}}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "SpecSourceError"},
+		},
+		{
+			name: "OpenAPI spec URL outside the allowlist backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.OpenAPISpecFrom = []CloudEndpointOpenAPISpecSource{{URL: "https://metadata.example.com/users.yaml"}}
+			},
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				config.OpenAPIURLAllowlist = "specs.example.com, https://other.example.com/specs/"
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "SpecSourceError"},
+		},
+		{
+			name: "OpenAPI spec URL without an allowlist backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.OpenAPISpecFrom = []CloudEndpointOpenAPISpecSource{{URL: "https://specs.example.com/users.yaml"}}
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "SpecSourceError"},
+		},
+	})
+}
+
+func TestOpenAPIURLAllowed(t *testing.T) {
+	allowlist := "specs.example.com, https://other.example.com/specs/, https://third.example.com/v1"
+	for specURL, want := range map[string]bool{
+		"https://specs.example.com/users.yaml":              true,
+		"http://specs.example.com/a/b/users.yaml":           true,
+		"https://other.example.com/specs/users.yaml":        true,
+		"https://other.example.com/specs":                   true,
+		"https://other.example.com/specs-private/users.yml": false,
+		"https://other.example.com/specs/../private.yaml":   false,
+		"http://other.example.com/specs/users.yaml":         false,
+		"https://third.example.com/v1/users.yaml":           true,
+		"https://third.example.com/v10/users.yaml":          false,
+		"https://metadata.example.com/users.yaml":           false,
+	} {
+		u, _ := url.Parse(specURL)
+		if got := openAPIURLAllowed(u, allowlist); got != want {
+			t.Errorf("openAPIURLAllowed(%s) = %v, want %v", specURL, got, want)
+		}
+	}
+	u, _ := url.Parse("https://specs.example.com/users.yaml")
+	if openAPIURLAllowed(u, " ") {
+		t.Errorf("openAPIURLAllowed() with an empty allowlist = true, want false")
+	}
+}
+
+func TestGetOpenAPISpecURLRedirects(t *testing.T) {
+	newTestEnv(nil, nil)
+	sum := sha256.Sum256([]byte(testOpenAPISpec))
+	checksum := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/specs/moved.yaml":
+			http.Redirect(w, r, "/specs/users.yaml", http.StatusFound)
+		case "/specs/private.yaml":
+			http.Redirect(w, r, "/specs-private/users.yaml", http.StatusFound)
+		default:
+			fmt.Fprint(w, testOpenAPISpec)
+		}
+	}))
+	defer server.Close()
+	config.OpenAPIURLAllowlist = server.URL + "/specs"
+
+	if data, err := getOpenAPISpecURL(server.URL+"/specs/moved.yaml", checksum); err != nil || data != testOpenAPISpec {
+		t.Errorf("redirect inside the allowlist = %v", err)
+	}
+	if _, err := getOpenAPISpecURL(server.URL+"/specs/private.yaml", checksum); err == nil || strings.Contains(err.Error(), "allowlist") == false {
+		t.Errorf("redirect outside the allowlist = %v, want an allowlist error", err)
+	}
+}
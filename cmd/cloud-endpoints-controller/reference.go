@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Annotation on a namespace listing the namespaces whose CloudEndpoints may reference its Ingresses, Gateways and Services.
+// The value is a comma separated list of namespaces, or "*" to allow every namespace.
+const allowReferencesAnnotation = "ctl.isla.solutions/allow-references-from"
+
+// referenceNotAllowedError is returned when a CloudEndpoint references an object in a namespace that does not allow it.
+type referenceNotAllowedError struct {
+	msg string
+}
+
+func (e referenceNotAllowedError) Error() string {
+	return e.msg
+}
+
+// targetIngressSpec returns the targetIngress spec with the namespace defaulted to the namespace of the CloudEndpoint.
+func targetIngressSpec(parent *CloudEndpoint) CloudEndpointTargetIngressSpec {
+	spec := parent.Spec.TargetIngress
+	if spec.Namespace == "" {
+		spec.Namespace = parent.Namespace
+	}
+	return spec
+}
+
+// checkReference returns a referenceNotAllowedError unless the object is in the namespace of the CloudEndpoint,
+// cross namespace references are allowed globally, or the namespace of the object allows references from the CloudEndpoint namespace.
+func checkReference(parent *CloudEndpoint, kind, namespace, name string) error {
+	if namespace == parent.Namespace || config.AllowCrossNamespaceRefs {
+		return nil
+	}
+	ns, err := getNamespace(namespace)
+	if err != nil {
+		return referenceNotAllowedError{fmt.Sprintf("%s %s/%s is in another namespace and namespace %s could not be read: %v", kind, namespace, name, namespace, err)}
+	}
+	for _, allowed := range strings.Split(ns.Annotations[allowReferencesAnnotation], ",") {
+		if allowed = strings.TrimSpace(allowed); allowed == "*" || allowed == parent.Namespace {
+			return nil
+		}
+	}
+	return referenceNotAllowedError{fmt.Sprintf("%s %s/%s is in another namespace, annotate namespace %s with %s: %s to allow it", kind, namespace, name, namespace, allowReferencesAnnotation, parent.Namespace)}
+}
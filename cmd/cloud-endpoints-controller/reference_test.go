@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSyncCrossNamespaceReferences(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "cross namespace Ingress without the namespace annotation waits",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web", Namespace: "other"}
+			},
+			objects:    []runtime.Object{testNamespace("other", nil)},
+			targets:    []runtime.Object{testIngress("other", "web", []string{"203.0.113.40"})},
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionTargetResolved: "ReferenceNotAllowed"},
+		},
+		{
+			name: "cross namespace Ingress allowed by the namespace annotation",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web", Namespace: "other"}
+			},
+			objects: []runtime.Object{testNamespace("other", map[string]string{allowReferencesAnnotation: "default"})},
+			targets: []runtime.Object{testIngress("other", "web", []string{"203.0.113.40"})},
+			syncs:   4,
+			state:   StateIdle,
+		},
+	})
+}
+
+func TestCheckReference(t *testing.T) {
+	newTestEnv([]runtime.Object{
+		testNamespace("shared", map[string]string{allowReferencesAnnotation: "team-a, default"}),
+		testNamespace("public", map[string]string{allowReferencesAnnotation: "*"}),
+		testNamespace("private", nil),
+	}, nil)
+	parent := newTestParent()
+	for namespace, allowed := range map[string]bool{
+		"default": true,
+		"shared":  true,
+		"public":  true,
+		"private": false,
+		"missing": false,
+	} {
+		err := checkReference(parent, "Service", namespace, "web")
+		if _, notAllowed := err.(referenceNotAllowedError); (err == nil) != allowed || (err != nil && notAllowed == false) {
+			t.Errorf("checkReference(%s) = %v, want allowed %v", namespace, err, allowed)
+		}
+	}
+
+	config.AllowCrossNamespaceRefs = true
+	if err := checkReference(parent, "Service", "private", "web"); err != nil {
+		t.Errorf("checkReference(private) with --allow-cross-namespace-refs = %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func createRollout(ctx context.Context, ep string, percentages map[string]float64) (*servicemanagement.Operation, error) {
+	return config.clientServiceMan.CreateRollout(ctx, ep, &servicemanagement.Rollout{
+		TrafficPercentStrategy: &servicemanagement.TrafficPercentStrategy{
+			Percentages: percentages,
+		},
+	})
+}
+
+// getServingConfig returns the config with the largest traffic percent, ignoring the given config.
+func getServingConfig(percentages map[string]float64, ignoreConfig string) string {
+	serving := ""
+	max := 0.0
+	for cfg, pct := range percentages {
+		if cfg != ignoreConfig && pct > max {
+			serving = cfg
+			max = pct
+		}
+	}
+	return serving
+}
+
+// rolloutPercentages returns the traffic split with percent sent to cfg and the remaining traffic sent to previousConfig.
+func rolloutPercentages(cfg, previousConfig string, percent float64) map[string]float64 {
+	if percent >= 100.0 || previousConfig == "" {
+		return map[string]float64{cfg: 100.0}
+	}
+	return map[string]float64{
+		cfg:            percent,
+		previousConfig: 100.0 - percent,
+	}
+}
+
+// rolloutStepPercent returns the traffic percent of the given step, steps past the end of the list are 100 percent.
+func rolloutStepPercent(spec *CloudEndpointRolloutSpec, step int) float64 {
+	if spec == nil || step >= len(spec.Steps) {
+		return 100.0
+	}
+	if pct := spec.Steps[step].Percent; pct > 0.0 && pct < 100.0 {
+		return pct
+	}
+	return 100.0
+}
+
+func rolloutStepWait(spec *CloudEndpointRolloutSpec, step int) (time.Duration, error) {
+	if spec == nil || step >= len(spec.Steps) || spec.Steps[step].Wait == "" {
+		return 0, nil
+	}
+	wait, err := time.ParseDuration(spec.Steps[step].Wait)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid rollout.steps[%d].wait: '%s', %v", step, spec.Steps[step].Wait, err)
+	}
+	return wait, nil
+}
+
+// advanceRollout aborts, holds or promotes a staged rollout after the rollout operation of the current step completes.
+// An abort is only applied once, a rollout started while status.abortedConfig is set is not aborted until abort is cleared and set again.
+// Returns the name of the new rollout operation, or an empty string if the rollout stays at the current step.
+func advanceRollout(ctx context.Context, parent *CloudEndpoint, status *CloudEndpointControllerStatus) (string, error) {
+	ep := status.Endpoint
+	cfg := status.Config
+	spec := parent.Spec.Rollout
+	percent := status.RolloutPercentages[cfg]
+
+	if spec != nil && spec.Abort && status.AbortedConfig == "" {
+		loggerFrom(ctx).WithFields(logrus.Fields{"config": cfg, "previousConfig": status.PreviousConfig}).Info("Aborting rollout, rolling back to previous config")
+		percentages := rolloutPercentages(status.PreviousConfig, "", 100.0)
+		op, err := createRollout(ctx, ep, percentages)
+		if err != nil {
+			return "", fmt.Errorf("Failed to create rollback rollout for: endpoint: %s, config: %s, %v", ep, status.PreviousConfig, err)
+		}
+		status.RolloutPercentages = percentages
+		status.RolloutAborted = true
+		status.AbortedConfig = cfg
+		status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutAborting", fmt.Sprintf("Rolling back to config: %s", status.PreviousConfig))
+		recordEvent(parent, corev1.EventTypeNormal, "RolloutStarted", "Started rollback to config %s for endpoint %s", status.PreviousConfig, ep)
+		return op.Name, nil
+	}
+
+	if spec != nil && spec.Paused {
+		status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutPaused", fmt.Sprintf("Rollout of config %s paused at %v%%", cfg, percent))
+		return "", nil
+	}
+
+	wait, err := rolloutStepWait(spec, status.RolloutStep)
+	if err != nil {
+		return "", err
+	}
+	if status.RolloutStepTime != nil && time.Now().Before(status.RolloutStepTime.Add(wait)) {
+		status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutStepWaiting", fmt.Sprintf("Config %s serving %v%% of traffic, next step after %s", cfg, percent, status.RolloutStepTime.Add(wait).UTC().Format(time.RFC3339)))
+		return "", nil
+	}
+
+	step := status.RolloutStep + 1
+	percentages := rolloutPercentages(cfg, status.PreviousConfig, rolloutStepPercent(spec, step))
+	loggerFrom(ctx).WithFields(logrus.Fields{"config": cfg, "step": step, "percentages": percentages}).Info("Promoting rollout to next step")
+	op, err := createRollout(ctx, ep, percentages)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create rollout for: endpoint: %s, config: %s, %v", ep, cfg, err)
+	}
+	status.RolloutStep = step
+	status.RolloutPercentages = percentages
+	stepTime := metav1.Now()
+	status.RolloutStepTime = &stepTime
+	status.setCondition(ConditionRolloutComplete, corev1.ConditionFalse, "RolloutPending", fmt.Sprintf("Waiting for rollout operation: %s", op.Name))
+	recordEvent(parent, corev1.EventTypeNormal, "RolloutStarted", "Started rollout step %d of config %s for endpoint %s, percentages: %v", step, cfg, ep, percentages)
+	return op.Name, nil
+}
+
+// abortCleared returns true if a rollout was aborted and spec.rollout.abort is no longer set.
+func abortCleared(parent *CloudEndpoint, status *CloudEndpointControllerStatus) bool {
+	return status.AbortedConfig != "" && (parent.Spec.Rollout == nil || parent.Spec.Rollout.Abort == false)
+}
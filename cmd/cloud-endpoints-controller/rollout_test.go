@@ -0,0 +1,152 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSyncRollout(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "staged rollout waits at the first step",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10, Wait: "1h"}}}
+			},
+			setup:      func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:      4,
+			state:      StateEndpointRolloutPending,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutStepWaiting"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if pct := status.RolloutPercentages["2018-01-01r1"]; pct != 10.0 || status.PreviousConfig != "2018-01-01r0" {
+					t.Errorf("rolloutPercentages = %v, previousConfig = %s", status.RolloutPercentages, status.PreviousConfig)
+				}
+			},
+		},
+		{
+			name: "staged rollout promotes the next step",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}}}
+			},
+			setup:      func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:      5,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutComplete"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if pct := env.sm.rollouts[testEndpoint][0].TrafficPercentStrategy.Percentages["2018-01-01r1"]; pct != 100.0 {
+					t.Errorf("latest rollout percent = %v, want 100", pct)
+				}
+			},
+		},
+		{
+			name: "paused rollout holds the step",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}}, Paused: true}
+			},
+			setup:      func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:      5,
+			state:      StateEndpointRolloutPending,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutPaused"},
+		},
+		{
+			name: "aborted rollout rolls back to the previous config",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}}, Abort: true}
+			},
+			setup:      func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:      5,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutAborted"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if pct := env.sm.rollouts[testEndpoint][0].TrafficPercentStrategy.Percentages["2018-01-01r0"]; pct != 100.0 {
+					t.Errorf("latest rollout percent of the previous config = %v, want 100", pct)
+				}
+				if status.AbortedConfig != "2018-01-01r1" {
+					t.Errorf("abortedConfig = %s, want 2018-01-01r1", status.AbortedConfig)
+				}
+			},
+		},
+		{
+			name: "clearing abort rolls the config out again",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}}, Abort: true}
+			},
+			setup:   func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:   5,
+			update:  func(parent *CloudEndpoint) { parent.Spec.Rollout.Abort = false },
+			resyncs: 5,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if pct := env.sm.rollouts[testEndpoint][0].TrafficPercentStrategy.Percentages["2018-01-01r1"]; pct != 100.0 {
+					t.Errorf("latest rollout percent = %v, want 100", pct)
+				}
+				if status.AbortedConfig != "" || status.RolloutAborted || len(env.sm.submitted) != 1 {
+					t.Errorf("abortedConfig = %s, rolloutAborted = %v, %d configs submitted", status.AbortedConfig, status.RolloutAborted, len(env.sm.submitted))
+				}
+			},
+		},
+		{
+			name: "spec change after an abort starts a new rollout",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}}, Abort: true}
+			},
+			setup:      func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:      5,
+			update:     func(parent *CloudEndpoint) { parent.Spec.Target = "203.0.113.11" },
+			resyncs:    5,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutComplete"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Config != "2018-01-01r2" || status.IngressIP != "203.0.113.11" {
+					t.Errorf("config = %s, ingressIP = %s, want 2018-01-01r2, 203.0.113.11", status.Config, status.IngressIP)
+				}
+				if pct := env.sm.rollouts[testEndpoint][0].TrafficPercentStrategy.Percentages["2018-01-01r2"]; pct != 100.0 {
+					t.Errorf("latest rollout percent = %v, want 100", pct)
+				}
+			},
+		},
+		{
+			name: "spec change while paused starts a new rollout",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Rollout = &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}}, Paused: true}
+			},
+			setup:      func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env) },
+			syncs:      5,
+			update:     func(parent *CloudEndpoint) { parent.Spec.Target = "203.0.113.11" },
+			resyncs:    5,
+			state:      StateEndpointRolloutPending,
+			conditions: map[CloudEndpointConditionType]string{ConditionRolloutComplete: "RolloutPaused"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Config != "2018-01-01r2" || status.PreviousConfig != "2018-01-01r0" || status.RolloutPercentages["2018-01-01r2"] != 10.0 {
+					t.Errorf("config = %s, previousConfig = %s, rolloutPercentages = %v", status.Config, status.PreviousConfig, status.RolloutPercentages)
+				}
+			},
+		},
+	})
+}
+
+func TestRolloutPercentages(t *testing.T) {
+	spec := &CloudEndpointRolloutSpec{Steps: []CloudEndpointRolloutStep{{Percent: 10}, {Percent: 0}, {Percent: 50}}}
+	tests := []struct {
+		step     int
+		previous string
+		want     map[string]float64
+	}{
+		{0, "r0", map[string]float64{"r1": 10.0, "r0": 90.0}},
+		{1, "r0", map[string]float64{"r1": 100.0}},
+		{2, "r0", map[string]float64{"r1": 50.0, "r0": 50.0}},
+		{3, "r0", map[string]float64{"r1": 100.0}},
+		{0, "", map[string]float64{"r1": 100.0}},
+	}
+	for _, tc := range tests {
+		if got := rolloutPercentages("r1", tc.previous, rolloutStepPercent(spec, tc.step)); reflect.DeepEqual(got, tc.want) == false {
+			t.Errorf("step %d with previous config '%s' = %v, want %v", tc.step, tc.previous, got, tc.want)
+		}
+	}
+
+	if serving := getServingConfig(map[string]float64{"r1": 10.0, "r0": 90.0}, "r2"); serving != "r0" {
+		t.Errorf("serving config = %s, want r0", serving)
+	}
+	if serving := getServingConfig(map[string]float64{"r1": 100.0}, "r1"); serving != "" {
+		t.Errorf("serving config = %s, want none", serving)
+	}
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	kubeinformers "k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	//ModeMetacontroller serves the sync and finalize hooks of a metacontroller CompositeController
+	ModeMetacontroller = "metacontroller"
+	//ModeStandalone watches CloudEndpoints with informers and updates the status subresource directly
+	ModeStandalone = "standalone"
+
+	// Finalizer added to CloudEndpoints in standalone mode so the endpoint service is cleaned up before the object is deleted.
+	standaloneFinalizer = "ctl.isla.solutions/cloud-endpoints-controller"
+	// Resync period of the informers, IDLE CloudEndpoints are checked for drift at this interval.
+	standaloneResyncPeriod = 5 * time.Minute
+	// Delay before a CloudEndpoint with a pending operation is synced again, same as the CompositeController resyncPeriodSeconds.
+	standalonePendingDelay = 2 * time.Second
+
+	dependencyIndex = "dependency"
+)
+
+// standaloneController runs the sync() and finalize() state machines from a rate limited workqueue instead of metacontroller webhooks.
+type standaloneController struct {
+	client   *cloudEndpointClient
+	informer cache.SharedIndexInformer
+	queue    workqueue.RateLimitingInterface
+}
+
+// runStandalone starts the informers and workers and blocks until stopCh is closed.
+func runStandalone(workers int, stopCh <-chan struct{}) error {
+	client, err := newCloudEndpointClient(config.clusterConfig)
+	if err != nil {
+		return err
+	}
+
+	factory := kubeinformers.NewSharedInformerFactory(config.clientset, standaloneResyncPeriod)
+	services := factory.Core().V1().Services()
+	configMaps := factory.Core().V1().ConfigMaps()
+	namespaces := factory.Core().V1().Namespaces()
+
+	c := &standaloneController{
+		client: client,
+		informer: cache.NewSharedIndexInformer(&cache.ListWatch{
+			ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+				return client.List(metav1.NamespaceAll, opts)
+			},
+			WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+				return client.Watch(metav1.NamespaceAll, opts)
+			},
+		}, &CloudEndpoint{}, standaloneResyncPeriod, cache.Indexers{dependencyIndex: dependencyIndexFunc}),
+		queue: workqueue.NewNamedRateLimitingQueue(workqueue.DefaultControllerRateLimiter(), cloudEndpointsResource),
+	}
+	defer c.queue.ShutDown()
+
+	c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			oldParent, newParent := oldObj.(*CloudEndpoint), newObj.(*CloudEndpoint)
+			// Skip the update events caused by our own status writes, resyncs have the same resourceVersion.
+			if oldParent.ResourceVersion != newParent.ResourceVersion && oldParent.Generation == newParent.Generation && oldParent.DeletionTimestamp.Equal(newParent.DeletionTimestamp) {
+				return
+			}
+			c.enqueue(newObj)
+		},
+	})
+	services.Informer().AddEventHandler(c.dependencyHandler("service"))
+	configMaps.Informer().AddEventHandler(c.dependencyHandler("configmap"))
+	namespaces.Informer().AddEventHandler(c.dependencyHandler("namespace"))
+
+	config.listers = &kubeListers{
+		targets:    make(map[schema.GroupVersionResource]cache.GenericLister),
+		services:   services.Lister(),
+		configMaps: configMaps.Lister(),
+		namespaces: namespaces.Lister(),
+	}
+	synced := []cache.InformerSynced{c.informer.HasSynced, services.Informer().HasSynced, configMaps.Informer().HasSynced, namespaces.Informer().HasSynced}
+
+	// Watch the Ingress and Gateway versions served by the cluster, targets with another apiVersion are fetched from the API server.
+	dynamicFactory := dynamicinformer.NewDynamicSharedInformerFactory(config.dynamicClient, standaloneResyncPeriod)
+	for _, kind := range []string{TargetKindIngress, TargetKindGateway} {
+		gvr, err := targetIngressGVR(CloudEndpointTargetIngressSpec{Kind: kind})
+		if err != nil || resourceServed(gvr) == false {
+			continue
+		}
+		targets := dynamicFactory.ForResource(gvr)
+		targets.Informer().AddEventHandler(c.dependencyHandler(targetDependencyKind(kind)))
+		config.listers.targets[gvr] = targets.Lister()
+		synced = append(synced, targets.Informer().HasSynced)
+	}
+
+	factory.Start(stopCh)
+	dynamicFactory.Start(stopCh)
+	go c.informer.Run(stopCh)
+
+	rootLogger.Info("Waiting for informer caches to sync")
+	if ok := cache.WaitForCacheSync(stopCh, synced...); ok == false {
+		return fmt.Errorf("Failed to wait for informer caches to sync")
+	}
+
+	rootLogger.WithField("workers", workers).Info("Starting standalone controller")
+	for i := 0; i < workers; i++ {
+		go wait.Until(c.runWorker, time.Second, stopCh)
+	}
+	<-stopCh
+	return nil
+}
+
+func (c *standaloneController) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// dependencyHandler enqueues the CloudEndpoints that reference the changed object of the given kind.
+func (c *standaloneController) dependencyHandler(kind string) cache.ResourceEventHandler {
+	enqueueDependents := func(obj interface{}) {
+		if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok == true {
+			obj = tombstone.Obj
+		}
+		m, err := meta.Accessor(obj)
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+		parents, err := c.informer.GetIndexer().ByIndex(dependencyIndex, dependencyKey(kind, m.GetNamespace(), m.GetName()))
+		if err != nil {
+			utilruntime.HandleError(err)
+			return
+		}
+		for _, parent := range parents {
+			c.enqueue(parent)
+		}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: enqueueDependents,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if oldObj.(metav1.Object).GetResourceVersion() == newObj.(metav1.Object).GetResourceVersion() {
+				return
+			}
+			enqueueDependents(newObj)
+		},
+		DeleteFunc: enqueueDependents,
+	}
+}
+
+func dependencyKey(kind, namespace, name string) string {
+	return kind + "/" + namespace + "/" + name
+}
+
+// targetDependencyKind returns the dependency kind of a targetIngress kind.
+func targetDependencyKind(kind string) string {
+	if kind == TargetKindGateway {
+		return "gateway"
+	}
+	return "ingress"
+}
+
+// dependencyIndexFunc indexes CloudEndpoints by the Ingress or Gateway, Services and ConfigMaps they read,
+// and by the other namespaces they reference so that changes to the allow references annotation are picked up.
+// Secrets are not watched, changes to them are picked up by the resync.
+func dependencyIndexFunc(obj interface{}) ([]string, error) {
+	parent, ok := obj.(*CloudEndpoint)
+	if ok == false {
+		return nil, fmt.Errorf("Unexpected object type: %T", obj)
+	}
+	keys := make([]string, 0)
+	if parent.Spec.TargetIngress.Name != "" {
+		ing := targetIngressSpec(parent)
+		keys = append(keys, dependencyKey(targetDependencyKind(targetIngressKind(ing)), ing.Namespace, ing.Name))
+		for _, svcName := range ing.JWTServices {
+			keys = append(keys, dependencyKey("service", ing.Namespace, svcName))
+		}
+		if ing.Namespace != parent.Namespace {
+			keys = append(keys, dependencyKey("namespace", "", ing.Namespace))
+		}
+	}
+	if svc := parent.Spec.TargetService; svc != nil {
+		ns := targetServiceNamespace(parent)
+		keys = append(keys, dependencyKey("service", ns, svc.Name))
+		if ns != parent.Namespace {
+			keys = append(keys, dependencyKey("namespace", "", ns))
+		}
+	}
+	if name := parent.Spec.OpenAPISpecConfigMap.Name; name != "" {
+		keys = append(keys, dependencyKey("configmap", parent.Namespace, name))
+	}
+	for _, src := range parent.Spec.OpenAPISpecFrom {
+		if src.ConfigMap != nil {
+			keys = append(keys, dependencyKey("configmap", parent.Namespace, src.ConfigMap.Name))
+		}
+	}
+	if grpc := parent.Spec.GRPC; grpc != nil {
+		if grpc.DescriptorSetConfigMap != nil {
+			keys = append(keys, dependencyKey("configmap", parent.Namespace, grpc.DescriptorSetConfigMap.Name))
+		}
+		if grpc.ServiceConfigConfigMap != nil {
+			keys = append(keys, dependencyKey("configmap", parent.Namespace, grpc.ServiceConfigConfigMap.Name))
+		}
+	}
+	return keys, nil
+}
+
+func (c *standaloneController) runWorker() {
+	for c.processNextItem() {
+	}
+}
+
+func (c *standaloneController) processNextItem() bool {
+	key, quit := c.queue.Get()
+	if quit {
+		return false
+	}
+	defer c.queue.Done(key)
+
+	requeueAfter, err := c.reconcile(key.(string))
+	if err != nil {
+		rootLogger.WithError(err).WithField("key", key).Error("Failed to reconcile CloudEndpoint")
+		c.queue.AddRateLimited(key)
+		return true
+	}
+	c.queue.Forget(key)
+	if requeueAfter > 0 {
+		c.queue.AddAfter(key, requeueAfter)
+	}
+	return true
+}
+
+// reconcile runs finalize() or sync() for the CloudEndpoint and writes the resulting status.
+// It returns the delay after which the CloudEndpoint must be synced again, or 0 to wait for the next event.
+func (c *standaloneController) reconcile(key string) (time.Duration, error) {
+	obj, exists, err := c.informer.GetIndexer().GetByKey(key)
+	if err != nil || exists == false {
+		return 0, err
+	}
+	parent := obj.(*CloudEndpoint).DeepCopy()
+	children := &CloudEndpointControllerRequestChildren{}
+
+	if parent.DeletionTimestamp != nil {
+		if hasFinalizer(parent) == false {
+			return 0, nil
+		}
+		ctx, logger := newSyncContext("finalize", parent)
+		status, _, finalized, err := finalize(ctx, parent, children)
+		if err != nil {
+			logger.WithError(err).Error("Could not finalize state")
+		}
+		if finalized {
+			removeFinalizer(parent)
+			_, err = c.client.Update(parent)
+			return 0, err
+		}
+		if updateErr := c.updateStatus(parent, status); updateErr != nil {
+			return 0, updateErr
+		}
+		return standalonePendingDelay, nil
+	}
+
+	if hasFinalizer(parent) == false {
+		parent.Finalizers = append(parent.Finalizers, standaloneFinalizer)
+		if parent, err = c.client.Update(parent); err != nil {
+			return 0, err
+		}
+	}
+
+	ctx, logger := newSyncContext("sync", parent)
+	status, _, err := sync(ctx, parent, children)
+	if err != nil {
+		// The error is reported in the Ready condition and retried by the state machine, same as in metacontroller mode.
+		logger.WithError(err).Error("Could not sync state")
+	}
+	if updateErr := c.updateStatus(parent, status); updateErr != nil {
+		return 0, updateErr
+	}
+
+	switch status.StateCurrent {
+	case StateIdle, StateFailed:
+		if err != nil {
+			return standalonePendingDelay, nil
+		}
+		return 0, nil
+	case StateBackoff:
+		if status.NextRetryTime != nil {
+			return time.Until(status.NextRetryTime.Time), nil
+		}
+	}
+	return standalonePendingDelay, nil
+}
+
+// updateStatus writes the status with the status subresource if it differs from the current status.
+func (c *standaloneController) updateStatus(parent *CloudEndpoint, status *CloudEndpointControllerStatus) error {
+	current, err := json.Marshal(parent.Status)
+	if err != nil {
+		return err
+	}
+	desired, err := json.Marshal(status)
+	if err != nil {
+		return err
+	}
+	if string(current) == string(desired) {
+		return nil
+	}
+	parent.Status = *status
+	_, err = c.client.UpdateStatus(parent)
+	return err
+}
+
+func hasFinalizer(parent *CloudEndpoint) bool {
+	for _, f := range parent.Finalizers {
+		if f == standaloneFinalizer {
+			return true
+		}
+	}
+	return false
+}
+
+func removeFinalizer(parent *CloudEndpoint) {
+	finalizers := make([]string, 0, len(parent.Finalizers))
+	for _, f := range parent.Finalizers {
+		if f != standaloneFinalizer {
+			finalizers = append(finalizers, f)
+		}
+	}
+	parent.Finalizers = finalizers
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	compute "google.golang.org/api/compute/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// Annotation of the GCE ingress controller naming the global address of the load balancer.
+	globalStaticIPAnnotation = "kubernetes.io/ingress.global-static-ip-name"
+
+	// Interval between global address checks while the address is being reserved and once it is reserved.
+	staticIPCheckPending  = 5 * time.Second
+	staticIPCheckReserved = 10 * time.Minute
+)
+
+// staticIPName returns the name of the global address, which defaults to cloudep-NAMESPACE-NAME.
+func staticIPName(parent *CloudEndpoint) string {
+	if name := parent.Spec.StaticIP.Name; name != "" {
+		return name
+	}
+	return computeResourceName(parent)
+}
+
+// syncStaticIP reserves the global static IP, records its address and annotates the target Ingress with its name.
+// Errors are reported with the StaticIPReserved condition, the target is not resolved until the address is known.
+func syncStaticIP(ctx context.Context, parent *CloudEndpoint, status *CloudEndpointControllerStatus) {
+	logger := loggerFrom(ctx)
+	// The static IP conditions are not the cause of a sync error.
+	defer func(reason string) { status.lastReason = reason }(status.lastReason)
+
+	name := ""
+	if parent.Spec.StaticIP != nil {
+		name = staticIPName(parent)
+	}
+
+	// Release an address that is no longer requested or was renamed.
+	if status.StaticIP != nil && status.StaticIP.Name != name {
+		if err := releaseStaticIP(ctx, parent, status); err != nil {
+			logger.WithError(err).Warn("Failed to release static IP")
+			return
+		}
+	}
+	if name == "" {
+		status.removeCondition(ConditionStaticIPReserved)
+		return
+	}
+
+	if status.StaticIP == nil {
+		status.StaticIP = &CloudEndpointStaticIPStatus{Name: name}
+	}
+	ip := status.StaticIP
+
+	interval := staticIPCheckPending
+	if ip.Address != "" {
+		interval = staticIPCheckReserved
+	}
+	if ip.CheckTime == nil || time.Since(ip.CheckTime.Time) >= interval {
+		checkTime := metav1.Now()
+		ip.CheckTime = &checkTime
+
+		addr, err := config.clientCompute.GetGlobalAddress(ctx, parent.Spec.Project, name)
+		if err != nil {
+			if computeNotFound(err) == false {
+				status.setCondition(ConditionStaticIPReserved, corev1.ConditionFalse, "GetFailed", err.Error())
+				return
+			}
+			ip.Address = ""
+			ip.Status = ""
+			if parent.Spec.StaticIP.Create == false {
+				status.setCondition(ConditionStaticIPReserved, corev1.ConditionFalse, "NotFound", fmt.Sprintf("Global address %s not found, set staticIP.create to reserve it", name))
+				return
+			}
+			logger.WithField("address", name).Info("Reserving global static IP")
+			_, err := config.clientCompute.InsertGlobalAddress(ctx, parent.Spec.Project, &compute.Address{
+				Name:        name,
+				Description: fmt.Sprintf("Static IP for CloudEndpoint %s/%s", parent.Namespace, parent.Name),
+				AddressType: "EXTERNAL",
+				IpVersion:   "IPV4",
+			})
+			if err != nil {
+				status.setCondition(ConditionStaticIPReserved, corev1.ConditionFalse, "ReserveFailed", err.Error())
+				recordEvent(parent, corev1.EventTypeWarning, "StaticIPReserveFailed", "Failed to reserve global static IP %s: %v", name, err)
+				return
+			}
+			ip.Created = true
+			status.setCondition(ConditionStaticIPReserved, corev1.ConditionFalse, "Reserving", fmt.Sprintf("Waiting for global static IP %s", name))
+			return
+		}
+		if addr.Address == "" || addr.Status == "RESERVING" {
+			status.setCondition(ConditionStaticIPReserved, corev1.ConditionFalse, "Reserving", fmt.Sprintf("Waiting for global static IP %s", name))
+			return
+		}
+		if ip.Address != addr.Address {
+			recordEvent(parent, corev1.EventTypeNormal, "StaticIPReserved", "Global static IP %s reserved: %s", name, addr.Address)
+		}
+		ip.Address = addr.Address
+		ip.Status = addr.Status
+	}
+	if ip.Address == "" {
+		return
+	}
+
+	if err := syncStaticIPIngress(ctx, parent, ip); err != nil {
+		logger.WithError(err).Warn("Failed to annotate Ingress with static IP")
+		status.setCondition(ConditionStaticIPReserved, corev1.ConditionFalse, "IngressAnnotationFailed", err.Error())
+		return
+	}
+	status.setCondition(ConditionStaticIPReserved, corev1.ConditionTrue, "Reserved", fmt.Sprintf("Global static IP %s: %s", name, ip.Address))
+}
+
+// syncStaticIPIngress sets the global-static-ip-name annotation of the target Ingress and removes it from a previously annotated Ingress.
+// A Gateway target is not annotated, its addresses are set in the Gateway spec.
+func syncStaticIPIngress(ctx context.Context, parent *CloudEndpoint, ip *CloudEndpointStaticIPStatus) error {
+	desired := ""
+	if parent.Spec.TargetIngress.Name != "" {
+		spec := targetIngressSpec(parent)
+		if targetIngressKind(spec) == TargetKindIngress {
+			if err := checkReference(parent, TargetKindIngress, spec.Namespace, spec.Name); err != nil {
+				return err
+			}
+			desired = spec.Namespace + "/" + spec.Name
+		}
+	}
+	if ip.Ingress == desired {
+		return nil
+	}
+	if ip.Ingress != "" {
+		if err := removeStaticIPAnnotation(ctx, ip.Ingress, ip.Name); err != nil {
+			return err
+		}
+		ip.Ingress = ""
+	}
+	if desired != "" {
+		loggerFrom(ctx).WithFields(logrus.Fields{"ingress": desired, "address": ip.Name}).Info("Patching Ingress global-static-ip-name annotation")
+		if err := patchIngressAnnotation(desired, globalStaticIPAnnotation, ip.Name); err != nil {
+			return err
+		}
+		ip.Ingress = desired
+		recordEvent(parent, corev1.EventTypeNormal, "IngressAnnotated", "Set global static IP %s on Ingress %s", ip.Name, desired)
+	}
+	return nil
+}
+
+// removeStaticIPAnnotation removes the global-static-ip-name annotation from the Ingress if it still names the address.
+func removeStaticIPAnnotation(ctx context.Context, key, name string) error {
+	annotations, err := getIngressAnnotations(key)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if annotations[globalStaticIPAnnotation] != name {
+		return nil
+	}
+	loggerFrom(ctx).WithField("ingress", key).Info("Removing Ingress global-static-ip-name annotation")
+	return patchIngressAnnotation(key, globalStaticIPAnnotation, nil)
+}
+
+// releaseStaticIP removes the address from the annotated Ingress and, following the deletion policy, deletes it if it was reserved by the controller.
+// Deleting fails while the address is still used by a load balancer, the caller retries on the next sync.
+func releaseStaticIP(ctx context.Context, parent *CloudEndpoint, status *CloudEndpointControllerStatus) error {
+	ip := status.StaticIP
+	if ip.Ingress != "" {
+		if err := removeStaticIPAnnotation(ctx, ip.Ingress, ip.Name); err != nil {
+			return err
+		}
+		ip.Ingress = ""
+	}
+	policy := parent.Spec.DeletionPolicy
+	if ip.Created && (policy == "" || policy == DeletionPolicyDelete) {
+		loggerFrom(ctx).WithField("address", ip.Name).Info("Deleting global static IP")
+		if _, err := config.clientCompute.DeleteGlobalAddress(ctx, parent.Spec.Project, ip.Name); err != nil {
+			if computeNotFound(err) == false {
+				return fmt.Errorf("Failed to delete global static IP %s: %v", ip.Name, err)
+			}
+		} else {
+			recordEvent(parent, corev1.EventTypeNormal, "StaticIPDeleted", "Deleted global static IP %s", ip.Name)
+		}
+	}
+	status.StaticIP = nil
+	return nil
+}
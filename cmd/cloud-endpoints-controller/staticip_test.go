@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	compute "google.golang.org/api/compute/v1"
+)
+
+func seedStaticIP(env *testEnv, parent *CloudEndpoint, created bool) {
+	env.compute.globalAddresses[testComputeName] = &compute.Address{Name: testComputeName, Address: "203.0.113.50", Status: "RESERVED"}
+	parent.Status.StaticIP = &CloudEndpointStaticIPStatus{Name: testComputeName, Address: "203.0.113.50", Created: created}
+}
+
+func TestSyncStaticIP(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name:       "static IP is reserved",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.StaticIP = &CloudEndpointStaticIP{Create: true} },
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionStaticIPReserved: "Reserving", ConditionTargetResolved: "WaitingForStaticIP"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.StaticIP == nil || status.StaticIP.Created == false {
+					t.Errorf("static IP status = %+v, want created", status.StaticIP)
+				}
+			},
+		},
+		{
+			name: "existing static IP is the target",
+			spec: func(parent *CloudEndpoint) { parent.Spec.StaticIP = &CloudEndpointStaticIP{} },
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.compute.globalAddresses[testComputeName] = &compute.Address{Name: testComputeName, Address: "203.0.113.50", Status: "RESERVED"}
+			},
+			syncs:      4,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionStaticIPReserved: "Reserved"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.IngressIP != "203.0.113.50" || status.StaticIP.Created {
+					t.Errorf("ingressIP = %s, static IP status = %+v", status.IngressIP, status.StaticIP)
+				}
+			},
+		},
+		{
+			name:       "missing static IP without create waits",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.StaticIP = &CloudEndpointStaticIP{} },
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionStaticIPReserved: "NotFound", ConditionTargetResolved: "WaitingForStaticIP"},
+		},
+	})
+}
+
+func TestFinalizeStaticIP(t *testing.T) {
+	runFinalizeTests(t, []finalizeTest{
+		{
+			name:      "static IP reserved by the controller is deleted",
+			policy:    DeletionPolicyDelete,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env); seedStaticIP(env, parent, true) },
+			calls:     2,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.compute.globalAddresses[testComputeName]; ok {
+					t.Errorf("static IP %s not deleted", testComputeName)
+				}
+			},
+		},
+		{
+			name:      "existing static IP is kept",
+			policy:    DeletionPolicyDelete,
+			setup:     func(env *testEnv, parent *CloudEndpoint) { seedService(env); seedStaticIP(env, parent, false) },
+			calls:     2,
+			finalized: true,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.compute.globalAddresses[testComputeName]; ok == false {
+					t.Errorf("static IP %s deleted", testComputeName)
+				}
+			},
+		},
+	})
+}
@@ -1,5 +1,12 @@
 package main
 
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Default number of entries kept in status.configHistory when spec.configHistoryLimit is not set.
+const configHistoryDefaultLimit = 10
+
 func makeStatus(parent *CloudEndpoint, children *CloudEndpointControllerRequestChildren) *CloudEndpointControllerStatus {
 	status := CloudEndpointControllerStatus{
 		StateCurrent: "IDLE",
@@ -10,7 +17,7 @@ func makeStatus(parent *CloudEndpoint, children *CloudEndpointControllerRequestC
 	sig := calcParentSig(parent, "")
 
 	if parent.Status.LastAppliedSig != "" {
-		if parent.Status.StateCurrent == StateIdle && sig != parent.Status.LastAppliedSig {
+		if isRestartableState(parent.Status.StateCurrent) && parent.Status.BackoffState == "" && sig != parent.Status.LastAppliedSig {
 			changed = true
 			status.LastAppliedSig = ""
 		} else {
@@ -50,5 +57,135 @@ func makeStatus(parent *CloudEndpoint, children *CloudEndpointControllerRequestC
 		status.ConfigMapHash = parent.Status.ConfigMapHash
 	}
 
+	if parent.Status.LastError != "" && changed == false {
+		status.LastError = parent.Status.LastError
+	}
+
+	if parent.Status.FailedAttempts != 0 && changed == false {
+		status.FailedAttempts = parent.Status.FailedAttempts
+	}
+
+	if parent.Status.NextRetryTime != nil && changed == false {
+		status.NextRetryTime = parent.Status.NextRetryTime
+	}
+
+	if parent.Status.BackoffState != "" && changed == false {
+		status.BackoffState = parent.Status.BackoffState
+	}
+
+	if parent.Status.ConfigValidate != "" && changed == false {
+		status.ConfigValidate = parent.Status.ConfigValidate
+	}
+
+	if parent.Status.ValidatedConfigHash != "" && changed == false {
+		status.ValidatedConfigHash = parent.Status.ValidatedConfigHash
+	}
+
+	if parent.Status.ValidationDiagnostics != nil && changed == false {
+		status.ValidationDiagnostics = parent.Status.ValidationDiagnostics
+	}
+
+	if parent.Status.PreviousConfig != "" && changed == false {
+		status.PreviousConfig = parent.Status.PreviousConfig
+	}
+
+	if parent.Status.RolloutStep != 0 && changed == false {
+		status.RolloutStep = parent.Status.RolloutStep
+	}
+
+	if parent.Status.RolloutStepTime != nil && changed == false {
+		status.RolloutStepTime = parent.Status.RolloutStepTime
+	}
+
+	if parent.Status.RolloutPercentages != nil && changed == false {
+		status.RolloutPercentages = parent.Status.RolloutPercentages
+	}
+
+	if parent.Status.RolloutAborted && changed == false {
+		status.RolloutAborted = parent.Status.RolloutAborted
+	}
+
+	// The aborted config is always carried over so that a spec change does not abort the next rollout.
+	if parent.Status.AbortedConfig != "" {
+		status.AbortedConfig = parent.Status.AbortedConfig
+	}
+
+	if parent.Status.SubmittedConfigHash != "" && changed == false {
+		status.SubmittedConfigHash = parent.Status.SubmittedConfigHash
+	}
+
+	if parent.Status.ServiceConfigCount != 0 {
+		status.ServiceConfigCount = parent.Status.ServiceConfigCount
+	}
+
+	if parent.Status.StaleConfigCount != 0 {
+		status.StaleConfigCount = parent.Status.StaleConfigCount
+	}
+
+	if parent.Status.ServiceDelete != "" {
+		status.ServiceDelete = parent.Status.ServiceDelete
+	}
+
+	// The config history is always carried over so that it survives spec changes.
+	if parent.Status.ConfigHistory != nil {
+		status.ConfigHistory = parent.Status.ConfigHistory
+	}
+
+	// The certificate is always carried over so that it can be cleaned up after spec changes.
+	if parent.Status.Certificate != nil {
+		status.Certificate = parent.Status.Certificate
+	}
+
+	// The static IP is always carried over so that the reservation is not lost after spec changes.
+	if parent.Status.StaticIP != nil {
+		status.StaticIP = parent.Status.StaticIP
+	}
+
+	if parent.Status.StateTransitionTime != nil {
+		status.StateTransitionTime = parent.Status.StateTransitionTime
+	}
+
+	// Conditions are always carried over so that lastTransitionTime is preserved.
+	if parent.Status.Conditions != nil {
+		status.Conditions = parent.Status.Conditions
+	}
+
+	status.ObservedGeneration = parent.Status.ObservedGeneration
+
 	return &status
 }
+
+// isRestartableState returns true if a spec change in the given state should discard the current status and start a new sync.
+// A BACKOFF that resumes a pending operation is not restarted, see CloudEndpointControllerStatus.BackoffState.
+func isRestartableState(state string) bool {
+	return state == StateIdle || state == StateBackoff || state == StateFailed
+}
+
+// addConfigHistory appends the submitted config to the history, dropping the oldest entries past the history limit.
+func (s *CloudEndpointControllerStatus) addConfigHistory(cfg, sig, hash string, limit int) {
+	if limit <= 0 {
+		limit = configHistoryDefaultLimit
+	}
+	if n := len(s.ConfigHistory); n > 0 && s.ConfigHistory[n-1].Config == cfg {
+		return
+	}
+	s.ConfigHistory = append(s.ConfigHistory, CloudEndpointConfigHistory{
+		Config:     cfg,
+		Sig:        sig,
+		Hash:       hash,
+		SubmitTime: metav1.Now(),
+	})
+	if n := len(s.ConfigHistory); n > limit {
+		s.ConfigHistory = s.ConfigHistory[n-limit:]
+	}
+}
+
+// findConfigHistory returns the most recent history entry with the given rendered config hash, or nil if there is none.
+func (s *CloudEndpointControllerStatus) findConfigHistory(hash string) *CloudEndpointConfigHistory {
+	for i := len(s.ConfigHistory) - 1; i >= 0; i-- {
+		if s.ConfigHistory[i].Hash != "" && s.ConfigHistory[i].Hash == hash {
+			return &s.ConfigHistory[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSyncPinnedConfig(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name:  "pinned config is rolled out without a submit",
+			spec:  func(parent *CloudEndpoint) { parent.Spec.PinnedConfigID = "2018-01-01r0" },
+			setup: func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env); env.sm.rollouts[testEndpoint] = nil },
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Config != "2018-01-01r0" || len(env.sm.submitted) != 0 {
+					t.Errorf("config = %s, %d configs submitted", status.Config, len(env.sm.submitted))
+				}
+			},
+		},
+		{
+			name:       "missing pinned config backs off",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.PinnedConfigID = "2018-01-01r9" },
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionConfigSubmitted: "PinnedConfigNotFound"},
+		},
+		{
+			name:    "removing the pinned config submits the spec",
+			spec:    func(parent *CloudEndpoint) { parent.Spec.PinnedConfigID = "2018-01-01r0" },
+			setup:   func(env *testEnv, parent *CloudEndpoint) { seedServingConfig(env); env.sm.rollouts[testEndpoint] = nil },
+			syncs:   4,
+			update:  func(parent *CloudEndpoint) { parent.Spec.PinnedConfigID = "" },
+			resyncs: 4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.Config != "2018-01-01r1" || len(env.sm.submitted) != 1 {
+					t.Errorf("config = %s, %d configs submitted", status.Config, len(env.sm.submitted))
+				}
+			},
+		},
+	})
+}
+
+func TestConfigHistory(t *testing.T) {
+	status := &CloudEndpointControllerStatus{}
+	for i := 0; i < 4; i++ {
+		cfg := fmt.Sprintf("2018-01-01r%d", i)
+		status.addConfigHistory(cfg, "sig", "hash-"+cfg, 3)
+		status.addConfigHistory(cfg, "sig", "hash-"+cfg, 3)
+	}
+	if n := len(status.ConfigHistory); n != 3 || status.ConfigHistory[0].Config != "2018-01-01r1" {
+		t.Errorf("config history = %+v, want the last 3 configs", status.ConfigHistory)
+	}
+	if h := status.findConfigHistory("hash-2018-01-01r2"); h == nil || h.Config != "2018-01-01r2" {
+		t.Errorf("findConfigHistory() = %+v, want 2018-01-01r2", h)
+	}
+	if h := status.findConfigHistory("hash-2018-01-01r0"); h != nil {
+		t.Errorf("findConfigHistory() = %+v, want nil for a dropped config", h)
+	}
+}
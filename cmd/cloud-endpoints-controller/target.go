@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// Deadline of a DNS lookup of a target hostname.
+	targetLookupTimeout = 5 * time.Second
+	// Time the addresses of a target hostname are cached, so that change detection does not resolve it on every resync.
+	targetLookupCacheTTL = 30 * time.Second
+)
+
+// lookupIPAddr resolves target hostnames, replaced in tests.
+var lookupIPAddr = net.DefaultResolver.LookupIPAddr
+
+// targetLookupCache holds the last resolved addresses of every target hostname.
+var targetLookupCache = struct {
+	gosync.Mutex
+	entries map[string]targetLookupCacheEntry
+}{entries: make(map[string]targetLookupCacheEntry)}
+
+type targetLookupCacheEntry struct {
+	addrs       []net.IPAddr
+	resolveTime time.Time
+}
+
+// Annotations that make GKE provision an internal load balancer for a LoadBalancer Service.
+var internalLoadBalancerAnnotations = []string{
+	"cloud.google.com/load-balancer-type",
+	"networking.gke.io/load-balancer-type",
+}
+
+// targetServiceNamespace returns the namespace of the target Service, which defaults to the namespace of the CloudEndpoint.
+func targetServiceNamespace(parent *CloudEndpoint) string {
+	if ns := parent.Spec.TargetService.Namespace; ns != "" {
+		return ns
+	}
+	return parent.Namespace
+}
+
+// getTargetService returns the load balancer IPs and hostnames of the target Service, or nil while the load balancer is being provisioned.
+func getTargetService(ctx context.Context, parent *CloudEndpoint) ([]string, error) {
+	logger := loggerFrom(ctx)
+	spec := parent.Spec.TargetService
+	namespace := targetServiceNamespace(parent)
+
+	addressType := spec.AddressType
+	if addressType == "" {
+		addressType = AddressTypeExternal
+	}
+	if addressType != AddressTypeExternal && addressType != AddressTypeInternal {
+		return nil, fmt.Errorf("Invalid targetService.addressType: '%s', must be one of: %s, %s", spec.AddressType, AddressTypeExternal, AddressTypeInternal)
+	}
+
+	if err := checkReference(parent, "Service", namespace, spec.Name); err != nil {
+		return nil, err
+	}
+	svc, err := getService(namespace, spec.Name)
+	if err != nil {
+		logger.WithField("service", spec.Name).Info("Waiting for Service")
+		return nil, nil
+	}
+	if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+		return nil, fmt.Errorf("Service %s is not type LoadBalancer", spec.Name)
+	}
+	if spec.Port != 0 {
+		found := false
+		for _, p := range svc.Spec.Ports {
+			if p.Port == spec.Port {
+				found = true
+			}
+		}
+		if found == false {
+			return nil, fmt.Errorf("Service %s does not expose port %d", spec.Name, spec.Port)
+		}
+	}
+	if internal := isInternalLoadBalancer(svc); internal != (addressType == AddressTypeInternal) {
+		return nil, fmt.Errorf("Service %s does not have an %s load balancer, set targetService.addressType to match the load balancer type", spec.Name, strings.ToLower(addressType))
+	}
+
+	addresses := make([]string, 0)
+	for _, ing := range svc.Status.LoadBalancer.Ingress {
+		if ing.IP != "" {
+			addresses = append(addresses, ing.IP)
+		}
+		if ing.Hostname != "" {
+			addresses = append(addresses, ing.Hostname)
+		}
+	}
+	if len(addresses) == 0 {
+		logger.WithField("service", spec.Name).Info("Waiting for load balancer status from Service")
+		return nil, nil
+	}
+	return addresses, nil
+}
+
+func isInternalLoadBalancer(svc *corev1.Service) bool {
+	for _, a := range internalLoadBalancerAnnotations {
+		if strings.EqualFold(svc.Annotations[a], AddressTypeInternal) {
+			return true
+		}
+	}
+	return false
+}
+
+// targetAddressFamily returns the address family of the x-google-endpoints target, which defaults to IPv4.
+func targetAddressFamily(parent *CloudEndpoint) (string, error) {
+	switch parent.Spec.TargetAddressFamily {
+	case "":
+		return AddressFamilyIPv4, nil
+	case AddressFamilyIPv4, AddressFamilyIPv6:
+		return parent.Spec.TargetAddressFamily, nil
+	default:
+		return "", fmt.Errorf("Invalid targetAddressFamily: '%s', must be one of: %s, %s", parent.Spec.TargetAddressFamily, AddressFamilyIPv4, AddressFamilyIPv6)
+	}
+}
+
+// selectTarget returns the lowest address of the given family, so the same target is selected from an unordered load balancer status or DNS answer.
+// An empty string is returned when there is no address of the family yet.
+func selectTarget(ctx context.Context, addresses []string, family string) string {
+	candidates := targetCandidates(ctx, addresses, family)
+	if len(candidates) == 0 {
+		return ""
+	}
+	return candidates[0]
+}
+
+// targetCandidates returns the sorted IPs of the given family. Hostnames are resolved when no IP of the family is listed.
+func targetCandidates(ctx context.Context, addresses []string, family string) []string {
+	logger := loggerFrom(ctx)
+	ips := make([]net.IP, 0)
+	hostnames := make([]string, 0)
+	for _, addr := range addresses {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			hostnames = append(hostnames, addr)
+			continue
+		}
+		if ipFamily(ip) == family {
+			ips = append(ips, ip)
+		}
+	}
+	if len(ips) == 0 {
+		for _, host := range hostnames {
+			resolved, err := lookupTargetHostname(ctx, host)
+			if err != nil {
+				logger.WithError(err).WithField("hostname", host).Warn("Failed to resolve target hostname")
+				continue
+			}
+			for _, ip := range resolved {
+				if ipFamily(ip.IP) == family {
+					ips = append(ips, ip.IP)
+				}
+			}
+		}
+	}
+	sort.Slice(ips, func(i, j int) bool {
+		return bytes.Compare(ips[i].To16(), ips[j].To16()) < 0
+	})
+	candidates := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		if s := ip.String(); len(candidates) == 0 || candidates[len(candidates)-1] != s {
+			candidates = append(candidates, s)
+		}
+	}
+	return candidates
+}
+
+// lookupTargetHostname resolves the hostname with a deadline. The addresses are served from the cache for targetLookupCacheTTL, failed lookups are not cached.
+func lookupTargetHostname(ctx context.Context, host string) ([]net.IPAddr, error) {
+	targetLookupCache.Lock()
+	entry, ok := targetLookupCache.entries[host]
+	targetLookupCache.Unlock()
+	if ok == true && time.Since(entry.resolveTime) < targetLookupCacheTTL {
+		return entry.addrs, nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, targetLookupTimeout)
+	defer cancel()
+	addrs, err := lookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	targetLookupCache.Lock()
+	targetLookupCache.entries[host] = targetLookupCacheEntry{addrs: addrs, resolveTime: time.Now()}
+	targetLookupCache.Unlock()
+	return addrs, nil
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return AddressFamilyIPv4
+	}
+	return AddressFamilyIPv6
+}
+
+// currentTargets returns the addresses that could be selected as the x-google-endpoints target from the current load balancer status, or nil if they can't be resolved.
+func currentTargets(ctx context.Context, parent *CloudEndpoint) []string {
+	family, err := targetAddressFamily(parent)
+	if err != nil {
+		return nil
+	}
+	var addresses []string
+	if parent.Spec.TargetIngress.Name != "" {
+		spec := targetIngressSpec(parent)
+		if err := checkReference(parent, targetIngressKind(spec), spec.Namespace, spec.Name); err != nil {
+			return nil
+		}
+		_, addresses, err = resolveTargetIngress(spec)
+	} else if parent.Spec.TargetService != nil {
+		addresses, err = getTargetService(ctx, parent)
+	}
+	if err != nil {
+		return nil
+	}
+	return targetCandidates(ctx, addresses, family)
+}
+
+// removeString returns the list without the given string.
+func removeString(list []string, s string) []string {
+	result := make([]string, 0, len(list))
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// containsString returns true if the list contains the given string.
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSyncTargetService(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "target Service selects the lowest load balancer IP",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "web"}
+			},
+			objects: []runtime.Object{testLoadBalancerService("web", "203.0.113.20", "203.0.113.5")},
+			syncs:   4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.IngressIP != "203.0.113.5" {
+					t.Errorf("ingressIP = %s, want 203.0.113.5", status.IngressIP)
+				}
+			},
+		},
+		{
+			name: "target Service without a load balancer IP waits",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "web"}
+			},
+			objects:    []runtime.Object{testLoadBalancerService("web")},
+			syncs:      2,
+			state:      StateEndpointCreatePending,
+			conditions: map[CloudEndpointConditionType]string{ConditionTargetResolved: "WaitingForService"},
+		},
+		{
+			name: "target Service that is not a LoadBalancer backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "web"}
+			},
+			objects: []runtime.Object{&corev1.Service{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeClusterIP},
+			}},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionTargetResolved: "TargetServiceError"},
+		},
+	})
+}
+
+func TestSyncTargetSelection(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "target Service selects an IPv6 address",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "web"}
+				parent.Spec.TargetAddressFamily = AddressFamilyIPv6
+			},
+			objects: []runtime.Object{testLoadBalancerService("web", "203.0.113.20", "2001:db8::20", "2001:db8::5")},
+			syncs:   4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.IngressIP != "2001:db8::5" {
+					t.Errorf("ingressIP = %s, want 2001:db8::5", status.IngressIP)
+				}
+			},
+		},
+		{
+			name: "current target that is still listed does not trigger a change",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "web"}
+			},
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateIdle, Endpoint: testEndpoint, IngressIP: "203.0.113.20", LastAppliedSig: calcParentSig(parent, "")}
+			},
+			objects: []runtime.Object{testLoadBalancerService("web", "203.0.113.5", "203.0.113.20")},
+			syncs:   1,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(env.sm.services) != 0 || status.IngressIP != "203.0.113.20" {
+					t.Errorf("change detected, ingressIP = %s", status.IngressIP)
+				}
+			},
+		},
+		{
+			name: "current target that is no longer listed triggers a change",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetService = &CloudEndpointTargetServiceSpec{Name: "web"}
+			},
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				parent.Status = CloudEndpointControllerStatus{StateCurrent: StateIdle, Endpoint: testEndpoint, IngressIP: "203.0.113.30", LastAppliedSig: calcParentSig(parent, "")}
+			},
+			objects: []runtime.Object{testLoadBalancerService("web", "203.0.113.5", "203.0.113.20")},
+			syncs:   1,
+			state:   StateEndpointCreatePending,
+		},
+	})
+}
+
+func TestTargetCandidatesResolvesHostnames(t *testing.T) {
+	lookups := 0
+	defer func(f func(context.Context, string) ([]net.IPAddr, error)) { lookupIPAddr = f }(lookupIPAddr)
+	lookupIPAddr = func(ctx context.Context, host string) ([]net.IPAddr, error) {
+		if _, ok := ctx.Deadline(); ok == false {
+			t.Errorf("lookup of %s without a deadline", host)
+		}
+		lookups++
+		if host == "unknown.example.com" {
+			return nil, fmt.Errorf("no such host")
+		}
+		return []net.IPAddr{{IP: net.ParseIP("203.0.113.60")}, {IP: net.ParseIP("203.0.113.50")}, {IP: net.ParseIP("2001:db8::50")}}, nil
+	}
+
+	ctx := context.Background()
+	addresses := []string{"lb.example.com", "unknown.example.com"}
+	for i := 0; i < 2; i++ {
+		if got := targetCandidates(ctx, addresses, AddressFamilyIPv4); fmt.Sprint(got) != "[203.0.113.50 203.0.113.60]" {
+			t.Errorf("targetCandidates() = %v", got)
+		}
+	}
+	if lookups != 3 {
+		t.Errorf("%d lookups, want 3, the resolved hostname is cached and the failed one is not", lookups)
+	}
+
+	targetLookupCache.Lock()
+	entry := targetLookupCache.entries["lb.example.com"]
+	entry.resolveTime = time.Now().Add(-targetLookupCacheTTL)
+	targetLookupCache.entries["lb.example.com"] = entry
+	targetLookupCache.Unlock()
+	if got := targetCandidates(ctx, []string{"lb.example.com"}, AddressFamilyIPv6); fmt.Sprint(got) != "[2001:db8::50]" || lookups != 4 {
+		t.Errorf("targetCandidates() after the TTL = %v with %d lookups", got, lookups)
+	}
+	if got := targetCandidates(ctx, []string{"203.0.113.70", "lb.example.com"}, AddressFamilyIPv4); fmt.Sprint(got) != "[203.0.113.70]" || lookups != 4 {
+		t.Errorf("targetCandidates() with an IP = %v with %d lookups, want no lookup", got, lookups)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -12,22 +13,80 @@ const (
 	StateIdle = "IDLE"
 	//StateEndpointCreatePending means the endpoint is pending creation
 	StateEndpointCreatePending = "ENDPOINT_CREATE_PENDING"
+	//StateEndpointValidatePending means the endpoint config is pending server side validation
+	StateEndpointValidatePending = "ENDPOINT_VALIDATE_PENDING"
 	//StateEndpointSubmitPending means the endpoint is pending submission
 	StateEndpointSubmitPending = "ENDPOINT_SUBMIT_PENDING"
 	//StateEndpointRolloutPending means the endpoint is pending rollout
 	StateEndpointRolloutPending = "ENDPOINT_ROLLOUT_PENDING" // Pending Rollout
+	//StateEndpointDeletePending means the endpoint service is pending deletion
+	StateEndpointDeletePending = "ENDPOINT_DELETE_PENDING"
+	//StateBackoff means the last attempt failed and a retry is scheduled at status.nextRetryTime
+	StateBackoff = "BACKOFF"
+	//StateFailed means the retry limit was reached, the controller waits for a change before trying again
+	StateFailed = "FAILED"
+)
+
+const (
+	//AddressTypeExternal selects the address of an external load balancer
+	AddressTypeExternal = "External"
+	//AddressTypeInternal selects the address of an internal load balancer
+	AddressTypeInternal = "Internal"
+)
+
+const (
+	//AddressFamilyIPv4 selects the first IPv4 address of the target as the x-google-endpoints target
+	AddressFamilyIPv4 = "IPv4"
+	//AddressFamilyIPv6 selects the first IPv6 address of the target as the x-google-endpoints target
+	AddressFamilyIPv6 = "IPv6"
+)
+
+// CloudEndpointDeletionPolicy describes what happens to the Cloud Endpoints service when the CloudEndpoint is deleted.
+type CloudEndpointDeletionPolicy string
+
+const (
+	//DeletionPolicyDelete deletes the Cloud Endpoints service and waits for the delete operation to complete
+	DeletionPolicyDelete = "Delete"
+	//DeletionPolicyRetain keeps the Cloud Endpoints service but waits for any pending submit or rollout to complete, this is the default
+	DeletionPolicyRetain = "Retain"
+	//DeletionPolicyAbandon keeps the Cloud Endpoints service and finalizes immediately
+	DeletionPolicyAbandon = "Abandon"
+)
+
+// CloudEndpointConditionType is the type of a status condition. See the const definition below for enumerated types.
+type CloudEndpointConditionType string
+
+const (
+	//ConditionReady means the latest spec has been rolled out and there are no errors
+	ConditionReady = "Ready"
+	//ConditionServiceCreated means the Cloud Endpoints service exists
+	ConditionServiceCreated = "ServiceCreated"
+	//ConditionConfigSubmitted means the service config was submitted and accepted
+	ConditionConfigSubmitted = "ConfigSubmitted"
+	//ConditionRolloutComplete means the service config rollout has completed
+	ConditionRolloutComplete = "RolloutComplete"
+	//ConditionTargetResolved means the endpoint target address was resolved
+	ConditionTargetResolved = "TargetResolved"
+	//ConditionSpecValid means the rendered OpenAPI spec passed validation
+	ConditionSpecValid = "SpecValid"
+	//ConditionCertificateReady means the managed SSL certificate for the endpoint hostname is active
+	ConditionCertificateReady = "CertificateReady"
+	//ConditionStaticIPReserved means the global static IP used as the endpoint target is reserved
+	ConditionStaticIPReserved = "StaticIPReserved"
 )
 
 // SyncRequest describes the payload from the CompositeController hook
 type SyncRequest struct {
-	Parent   CloudEndpoint                          `json:"parent"`
-	Children CloudEndpointControllerRequestChildren `json:"children"`
+	Parent     CloudEndpoint                          `json:"parent"`
+	Children   CloudEndpointControllerRequestChildren `json:"children"`
+	Finalizing bool                                   `json:"finalizing"`
 }
 
 // SyncResponse is the CompositeController response structure.
 type SyncResponse struct {
-	Status   CloudEndpointControllerStatus `json:"status"`
-	Children []interface{}                 `json:"children"`
+	Status    CloudEndpointControllerStatus `json:"status"`
+	Children  []interface{}                 `json:"children"`
+	Finalized bool                          `json:"finalized"`
 }
 
 // CloudEndpointControllerRequestChildren is the children definition passed by the CompositeController request for the CloudEndpoint controller.
@@ -36,15 +95,89 @@ type CloudEndpointControllerRequestChildren struct {
 
 // CloudEndpointControllerStatus is the status structure for the custom resource
 type CloudEndpointControllerStatus struct {
-	LastAppliedSig string   `json:"lastAppliedSig"`
-	StateCurrent   string   `json:"stateCurrent"`
-	ConfigSubmit   string   `json:"configSubmit,omitempty"`
-	ServiceRollout string   `json:"serviceRollout,omitempty"`
-	Endpoint       string   `json:"endpoint"`
-	Config         string   `json:"config"`
-	IngressIP      string   `json:"ingressIP"`
-	JWTAudiences   []string `json:"jwtAudiences"`
-	ConfigMapHash  string   `json:"configMapHash"`
+	LastAppliedSig string       `json:"lastAppliedSig"`
+	StateCurrent   string       `json:"stateCurrent"`
+	ConfigSubmit   string       `json:"configSubmit,omitempty"`
+	ServiceRollout string       `json:"serviceRollout,omitempty"`
+	Endpoint       string       `json:"endpoint"`
+	Config         string       `json:"config"`
+	IngressIP      string       `json:"ingressIP"`
+	JWTAudiences   []string     `json:"jwtAudiences"`
+	ConfigMapHash  string       `json:"configMapHash"`
+	ServiceDelete  string       `json:"serviceDelete,omitempty"`
+	LastError      string       `json:"lastError,omitempty"`
+	FailedAttempts int          `json:"failedAttempts,omitempty"`
+	NextRetryTime  *metav1.Time `json:"nextRetryTime,omitempty"`
+	// BackoffState is the pending state resumed after the backoff when polling its operation failed.
+	BackoffState string `json:"backoffState,omitempty"`
+
+	ConfigValidate        string   `json:"configValidate,omitempty"`
+	ValidatedConfigHash   string   `json:"validatedConfigHash,omitempty"`
+	ValidationDiagnostics []string `json:"validationDiagnostics,omitempty"`
+
+	PreviousConfig     string             `json:"previousConfig,omitempty"`
+	RolloutStep        int                `json:"rolloutStep,omitempty"`
+	RolloutStepTime    *metav1.Time       `json:"rolloutStepTime,omitempty"`
+	RolloutPercentages map[string]float64 `json:"rolloutPercentages,omitempty"`
+	RolloutAborted     bool               `json:"rolloutAborted,omitempty"`
+	// AbortedConfig is the config rolled back by spec.rollout.abort, kept until the abort is cleared.
+	AbortedConfig string `json:"abortedConfig,omitempty"`
+
+	ConfigHistory       []CloudEndpointConfigHistory `json:"configHistory,omitempty"`
+	SubmittedConfigHash string                       `json:"submittedConfigHash,omitempty"`
+	ServiceConfigCount  int                          `json:"serviceConfigCount,omitempty"`
+	StaleConfigCount    int                          `json:"staleConfigCount,omitempty"`
+
+	StateTransitionTime *metav1.Time `json:"stateTransitionTime,omitempty"`
+
+	Certificate *CloudEndpointCertificateStatus `json:"certificate,omitempty"`
+	StaticIP    *CloudEndpointStaticIPStatus    `json:"staticIP,omitempty"`
+
+	// lastReason is the reason of the last condition set to False during a sync, used to label error metrics.
+	lastReason string
+
+	ObservedGeneration int64                    `json:"observedGeneration,omitempty"`
+	Conditions         []CloudEndpointCondition `json:"conditions,omitempty"`
+}
+
+// CloudEndpointCertificateStatus is the provisioning status of the managed SSL certificate, as reported by the Compute API. Created is true if the certificate
+// was created by the controller and Ingress is the namespace/name of the Ingress annotated with the certificate.
+type CloudEndpointCertificateStatus struct {
+	Name         string            `json:"name"`
+	Domain       string            `json:"domain"`
+	Status       string            `json:"status,omitempty"`
+	DomainStatus map[string]string `json:"domainStatus,omitempty"`
+	Created      bool              `json:"created,omitempty"`
+	Ingress      string            `json:"ingress,omitempty"`
+	CheckTime    *metav1.Time      `json:"checkTime,omitempty"`
+}
+
+// CloudEndpointStaticIPStatus is the global static IP used as the endpoint target. Created is true if the address was reserved by the controller
+// and Ingress is the namespace/name of the Ingress annotated with the address name.
+type CloudEndpointStaticIPStatus struct {
+	Name      string       `json:"name"`
+	Address   string       `json:"address,omitempty"`
+	Status    string       `json:"status,omitempty"`
+	Created   bool         `json:"created,omitempty"`
+	Ingress   string       `json:"ingress,omitempty"`
+	CheckTime *metav1.Time `json:"checkTime,omitempty"`
+}
+
+// CloudEndpointCondition describes the state of one aspect of the CloudEndpoint at a point in time.
+type CloudEndpointCondition struct {
+	Type               CloudEndpointConditionType `json:"type"`
+	Status             corev1.ConditionStatus     `json:"status"`
+	Reason             string                     `json:"reason,omitempty"`
+	Message            string                     `json:"message,omitempty"`
+	LastTransitionTime metav1.Time                `json:"lastTransitionTime,omitempty"`
+}
+
+// CloudEndpointConfigHistory is an entry in the list of configs submitted by the controller, most recent last.
+type CloudEndpointConfigHistory struct {
+	Config     string      `json:"config"`
+	Sig        string      `json:"sig"`
+	Hash       string      `json:"hash,omitempty"`
+	SubmitTime metav1.Time `json:"submitTime"`
 }
 
 // CloudEndpoint is the custom resource definition structure.
@@ -63,16 +196,150 @@ type CloudEndpointConfigMapSpec struct {
 
 // CloudEndpointSpec mirrors the IngressSpec with added IAPProjectAuthz spec and a custom Rules spec.
 type CloudEndpointSpec struct {
-	Project              string                         `json:"project,omitempty"`
-	Target               string                         `json:"target,omitempty"`
-	TargetIngress        CloudEndpointTargetIngressSpec `json:"targetIngress,omitempty"`
-	OpenAPISpec          string                         `json:"openAPISpec,omitempty"`
-	OpenAPISpecConfigMap CloudEndpointConfigMapSpec     `json:"openAPISpecConfigMap"`
+	Project              string                           `json:"project,omitempty"`
+	Target               string                           `json:"target,omitempty"`
+	TargetIngress        CloudEndpointTargetIngressSpec   `json:"targetIngress,omitempty"`
+	TargetService        *CloudEndpointTargetServiceSpec  `json:"targetService,omitempty"`
+	TargetAddressFamily  string                           `json:"targetAddressFamily,omitempty"`
+	OpenAPISpec          string                           `json:"openAPISpec,omitempty"`
+	OpenAPISpecConfigMap CloudEndpointConfigMapSpec       `json:"openAPISpecConfigMap"`
+	OpenAPISpecFrom      []CloudEndpointOpenAPISpecSource `json:"openAPISpecFrom,omitempty"`
+	DeletionPolicy       CloudEndpointDeletionPolicy      `json:"deletionPolicy,omitempty"`
+	GRPC                 *CloudEndpointGRPCSpec           `json:"grpc,omitempty"`
+	ServerSideValidation bool                             `json:"serverSideValidation,omitempty"`
+	DryRun               bool                             `json:"dryRun,omitempty"`
+	Rollout              *CloudEndpointRolloutSpec        `json:"rollout,omitempty"`
+	PinnedConfigID       string                           `json:"pinnedConfigId,omitempty"`
+	ConfigHistoryLimit   int                              `json:"configHistoryLimit,omitempty"`
+	ManagedCertificate   *CloudEndpointManagedCertificate `json:"managedCertificate,omitempty"`
+	StaticIP             *CloudEndpointStaticIP           `json:"staticIP,omitempty"`
+	Authentication       *CloudEndpointAuthentication     `json:"authentication,omitempty"`
+	APIKeys              *CloudEndpointAPIKeys            `json:"apiKeys,omitempty"`
+	Quota                *CloudEndpointQuota              `json:"quota,omitempty"`
+	Wildcard             *CloudEndpointWildcard           `json:"wildcard,omitempty"`
+}
+
+// CloudEndpointWildcard configures the wildcard spec used when no OpenAPI spec is given. With PathsFromIngress the paths are
+// derived from the targetIngress rules instead of a single /** path, Methods defaults to get, delete, patch, post and put,
+// and AllowAll adds x-google-allow: all so that calls to undefined paths and methods are allowed.
+type CloudEndpointWildcard struct {
+	PathsFromIngress bool     `json:"pathsFromIngress,omitempty"`
+	Methods          []string `json:"methods,omitempty"`
+	AllowAll         bool     `json:"allowAll,omitempty"`
+}
+
+// CloudEndpointAPIKeys requires an API key on the operations of the OpenAPI paths matching Paths, all operations when Paths is empty.
+// Paths are exact paths or glob patterns. The key is read from the Name query parameter (default "key") or header, as set by In.
+type CloudEndpointAPIKeys struct {
+	Paths []string `json:"paths,omitempty"`
+	Name  string   `json:"name,omitempty"`
+	In    string   `json:"in,omitempty"`
+}
+
+// CloudEndpointQuota defines the quota metrics and per minute limits of the endpoint and the cost of the operations.
+type CloudEndpointQuota struct {
+	Metrics []CloudEndpointQuotaMetric `json:"metrics,omitempty"`
+	Costs   []CloudEndpointQuotaCost   `json:"costs,omitempty"`
+}
+
+// CloudEndpointQuotaMetric is a quota metric with its limit per minute per consumer project.
+type CloudEndpointQuotaMetric struct {
+	Name           string `json:"name"`
+	DisplayName    string `json:"displayName,omitempty"`
+	LimitPerMinute int64  `json:"limitPerMinute"`
+}
+
+// CloudEndpointQuotaCost is the cost in Metric of the operations matching Paths and Methods, all operations when they are empty.
+type CloudEndpointQuotaCost struct {
+	Metric  string   `json:"metric"`
+	Cost    int64    `json:"cost"`
+	Paths   []string `json:"paths,omitempty"`
+	Methods []string `json:"methods,omitempty"`
+}
+
+// CloudEndpointAuthentication lists the JWT authentication providers rendered into the OpenAPI securityDefinitions.
+type CloudEndpointAuthentication struct {
+	Providers []CloudEndpointAuthProvider `json:"providers,omitempty"`
+}
+
+// CloudEndpointAuthProvider is a JWT issuer accepted by the endpoint. Name is the securityDefinitions key,
+// AudiencesFromJWTServices adds the audiences of the targetIngress.jwtServices to Audiences.
+type CloudEndpointAuthProvider struct {
+	Name                     string   `json:"name"`
+	Issuer                   string   `json:"issuer"`
+	JWKSURI                  string   `json:"jwksUri,omitempty"`
+	Audiences                []string `json:"audiences,omitempty"`
+	AudiencesFromJWTServices bool     `json:"audiencesFromJWTServices,omitempty"`
+}
+
+// CloudEndpointStaticIP pins the endpoint target to a global static IP. With Create the address is reserved by the controller,
+// otherwise Name must be an existing global address. Name defaults to a name derived from the CloudEndpoint.
+type CloudEndpointStaticIP struct {
+	Create bool   `json:"create,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// CloudEndpointManagedCertificate requests a Google-managed SSL certificate for the endpoint hostname.
+// Name defaults to a name derived from the CloudEndpoint, AnnotateIngress adds the certificate to the pre-shared-cert annotation of the targetIngress.
+type CloudEndpointManagedCertificate struct {
+	Name            string `json:"name,omitempty"`
+	AnnotateIngress bool   `json:"annotateIngress,omitempty"`
+}
+
+// CloudEndpointRolloutSpec configures a staged rollout where the previous config keeps the remaining traffic until the last step.
+// Paused stops promotion at the current step, Abort rolls back to the previous config.
+type CloudEndpointRolloutSpec struct {
+	Steps  []CloudEndpointRolloutStep `json:"steps,omitempty"`
+	Paused bool                       `json:"paused,omitempty"`
+	Abort  bool                       `json:"abort,omitempty"`
+}
+
+// CloudEndpointRolloutStep is the traffic percent sent to the new config and the time to wait before the next step, for example "10m".
+type CloudEndpointRolloutStep struct {
+	Percent float64 `json:"percent"`
+	Wait    string  `json:"wait,omitempty"`
+}
+
+// CloudEndpointOpenAPISpecSource is one OpenAPI spec file read from exactly one of ConfigMap, Secret or URL.
+// A URL source can be pinned with the hex encoded SHA256 checksum of its contents.
+type CloudEndpointOpenAPISpecSource struct {
+	ConfigMap *CloudEndpointConfigMapSpec `json:"configMap,omitempty"`
+	Secret    *CloudEndpointSecretSpec    `json:"secret,omitempty"`
+	URL       string                      `json:"url,omitempty"`
+	SHA256    string                      `json:"sha256,omitempty"`
+}
+
+// CloudEndpointSecretSpec is a reference to a key in a Secret in the same namespace as the CloudEndpoint
+type CloudEndpointSecretSpec struct {
+	Name string `json:"name"`
+	Key  string `json:"key"`
+}
+
+// CloudEndpointGRPCSpec is the subspec for CloudEndpointSpec that configures a gRPC endpoint.
+// The proto descriptor set is base64 encoded and is read from one of DescriptorSet, DescriptorSetConfigMap (binaryData) or DescriptorSetSecret.
+// The gRPC service config is a go template with the same substitutions as the OpenAPI spec, read from ServiceConfig or ServiceConfigConfigMap.
+type CloudEndpointGRPCSpec struct {
+	DescriptorSet          string                      `json:"descriptorSet,omitempty"`
+	DescriptorSetConfigMap *CloudEndpointConfigMapSpec `json:"descriptorSetConfigMap,omitempty"`
+	DescriptorSetSecret    *CloudEndpointSecretSpec    `json:"descriptorSetSecret,omitempty"`
+	ServiceConfig          string                      `json:"serviceConfig,omitempty"`
+	ServiceConfigConfigMap *CloudEndpointConfigMapSpec `json:"serviceConfigConfigMap,omitempty"`
+}
+
+// CloudEndpointTargetServiceSpec is a LoadBalancer Service whose load balancer IP is used as the target.
+// The namespace defaults to the namespace of the CloudEndpoint and AddressType is External (default) or Internal.
+type CloudEndpointTargetServiceSpec struct {
+	Name        string `json:"name"`
+	Namespace   string `json:"namespace,omitempty"`
+	Port        int32  `json:"port,omitempty"`
+	AddressType string `json:"addressType,omitempty"`
 }
 
 // CloudEndpointTargetIngressSpec is the format for the targetIngress spec
 type CloudEndpointTargetIngressSpec struct {
 	Name        string   `json:"name,omitempty"`
 	Namespace   string   `json:"namespace,omitempty"`
+	Kind        string   `json:"kind,omitempty"`
+	APIVersion  string   `json:"apiVersion,omitempty"`
 	JWTServices []string `json:"jwtServices,omitempty"`
 }
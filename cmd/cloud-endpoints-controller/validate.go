@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/go-openapi/loads"
+	"github.com/go-openapi/strfmt"
+	"github.com/go-openapi/validate"
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+)
+
+// validationError is returned by validateOpenAPISpec and holds one diagnostic message per problem found.
+type validationError struct {
+	diagnostics []string
+}
+
+func (e *validationError) Error() string {
+	return fmt.Sprintf("Invalid OpenAPI spec: %s", strings.Join(e.diagnostics, "; "))
+}
+
+// validationDiagnostics returns the diagnostics of a validationError, or the error message for other errors.
+func validationDiagnostics(err error) []string {
+	if verr, ok := err.(*validationError); ok {
+		return verr.diagnostics
+	}
+	return []string{err.Error()}
+}
+
+var openAPIOperations = []string{"get", "put", "post", "delete", "options", "head", "patch"}
+
+// placeholderAuthorizationURL replaces the empty authorizationUrl of JWT security definitions for the Swagger 2.0 schema check.
+const placeholderAuthorizationURL = "https://localhost/authorize"
+
+// validateOpenAPISpec validates the rendered spec against the Swagger 2.0 schema and checks the Cloud Endpoints specific fields.
+func validateOpenAPISpec(specOriginal string, endpoint string) error {
+	var spec map[string]interface{}
+	if err := yaml.Unmarshal([]byte(specOriginal), &spec); err != nil {
+		return err
+	}
+
+	diagnostics := make([]string, 0)
+
+	specJSON, err := yaml.YAMLToJSON([]byte(specOriginal))
+	if err != nil {
+		return err
+	}
+	specJSON, err = withPlaceholderAuthorizationURLs(specJSON)
+	if err != nil {
+		return err
+	}
+	doc, err := loads.Analyzed(json.RawMessage(specJSON), "")
+	if err != nil {
+		diagnostics = append(diagnostics, err.Error())
+	} else if err := validate.Spec(doc, strfmt.Default); err != nil {
+		diagnostics = append(diagnostics, err.Error())
+	}
+
+	if host, _ := spec["host"].(string); host != endpoint {
+		diagnostics = append(diagnostics, fmt.Sprintf("host must be '%s', found: '%v'", endpoint, spec["host"]))
+	}
+
+	if endpoints, ok := spec["x-google-endpoints"].([]interface{}); ok {
+		for i, e := range endpoints {
+			m, _ := e.(map[string]interface{})
+			if name, _ := m["name"].(string); name != endpoint {
+				diagnostics = append(diagnostics, fmt.Sprintf("x-google-endpoints[%d].name must be '%s', found: '%v'", i, endpoint, m["name"]))
+			}
+		}
+	}
+
+	securityDefinitions, _ := spec["securityDefinitions"].(map[string]interface{})
+	diagnostics = append(diagnostics, checkSecurityRequirements("security", spec["security"], securityDefinitions)...)
+
+	operationIDs := make(map[string][]string, 0)
+	paths, _ := spec["paths"].(map[string]interface{})
+	for path, p := range paths {
+		pathItem, _ := p.(map[string]interface{})
+		for _, method := range openAPIOperations {
+			op, ok := pathItem[method].(map[string]interface{})
+			if ok == false {
+				continue
+			}
+			location := fmt.Sprintf("paths.%s.%s", path, method)
+			if id, _ := op["operationId"].(string); id != "" {
+				operationIDs[id] = append(operationIDs[id], location)
+			}
+			diagnostics = append(diagnostics, checkSecurityRequirements(location+".security", op["security"], securityDefinitions)...)
+		}
+	}
+	for id, locations := range operationIDs {
+		if len(locations) > 1 {
+			sort.Strings(locations)
+			diagnostics = append(diagnostics, fmt.Sprintf("operationId '%s' is not unique, used by: %s", id, strings.Join(locations, ", ")))
+		}
+	}
+
+	if len(diagnostics) > 0 {
+		sort.Strings(diagnostics)
+		return &validationError{diagnostics}
+	}
+	return nil
+}
+
+// withPlaceholderAuthorizationURLs sets the empty authorizationUrl of security definitions with an x-google-issuer to a placeholder.
+// Cloud Endpoints JWT providers are declared with authorizationUrl: "", which the Swagger 2.0 schema rejects as an invalid uri.
+func withPlaceholderAuthorizationURLs(specJSON []byte) ([]byte, error) {
+	var spec map[string]interface{}
+	if err := json.Unmarshal(specJSON, &spec); err != nil {
+		return nil, err
+	}
+	securityDefinitions, _ := spec["securityDefinitions"].(map[string]interface{})
+	for _, d := range securityDefinitions {
+		def, _ := d.(map[string]interface{})
+		if u, ok := def["authorizationUrl"].(string); ok && u == "" && def["x-google-issuer"] != nil {
+			def["authorizationUrl"] = placeholderAuthorizationURL
+		}
+	}
+	return json.Marshal(spec)
+}
+
+// checkSecurityRequirements returns a diagnostic for every security requirement that references a missing securityDefinition.
+func checkSecurityRequirements(location string, security interface{}, securityDefinitions map[string]interface{}) []string {
+	diagnostics := make([]string, 0)
+	requirements, _ := security.([]interface{})
+	for _, r := range requirements {
+		requirement, _ := r.(map[string]interface{})
+		for name := range requirement {
+			if _, ok := securityDefinitions[name]; ok == false {
+				diagnostics = append(diagnostics, fmt.Sprintf("%s references undefined securityDefinition: '%s'", location, name))
+			}
+		}
+	}
+	return diagnostics
+}
+
+// getOperationDiagnostics returns the diagnostics reported by a validate only config submit operation.
+func getOperationDiagnostics(op *servicemanagement.Operation) []string {
+	diagnostics := make([]string, 0)
+	if op.Error == nil {
+		return diagnostics
+	}
+	diagnostics = append(diagnostics, op.Error.Message)
+	for _, detail := range op.Error.Details {
+		var d servicemanagement.Diagnostic
+		data, _ := detail.MarshalJSON()
+		if err := json.Unmarshal(data, &d); err == nil && d.Message != "" {
+			diagnostics = append(diagnostics, fmt.Sprintf("%s: %s: %s", d.Kind, d.Location, d.Message))
+		}
+	}
+	return diagnostics
+}
+
+// configFilesHash returns the hash of the rendered config files used to detect if a config was already validated.
+func configFilesHash(files []*servicemanagement.ConfigFile) string {
+	var b strings.Builder
+	for _, f := range files {
+		b.WriteString(f.FilePath)
+		b.WriteString(f.FileType)
+		b.WriteString(f.FileContents)
+	}
+	return toSha1(b.String())
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	servicemanagement "google.golang.org/api/servicemanagement/v1"
+)
+
+func TestSyncValidation(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "invalid OpenAPI spec backs off",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.OpenAPISpec = strings.Replace(testOpenAPISpec, `host: "{{ .Endpoint }}"`, `host: "other.example.com"`, 1)
+			},
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "InvalidSpec"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(status.ValidationDiagnostics) == 0 {
+					t.Errorf("no validation diagnostics")
+				}
+			},
+		},
+		{
+			name:       "template error backs off",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.OpenAPISpec = testOpenAPISpec + "{{ .Missing" },
+			syncs:      2,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "TemplateError"},
+		},
+		{
+			name:  "server side validation waits for the validate operation",
+			spec:  func(parent *CloudEndpoint) { parent.Spec.ServerSideValidation = true },
+			syncs: 2,
+			state: StateEndpointValidatePending,
+		},
+		{
+			name:  "server side validation submits after the validate operation",
+			spec:  func(parent *CloudEndpoint) { parent.Spec.ServerSideValidation = true },
+			syncs: 4,
+			state: StateEndpointSubmitPending,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.ValidatedConfigHash == "" || len(env.sm.submitted) != 1 {
+					t.Errorf("validatedConfigHash = %s, %d configs submitted", status.ValidatedConfigHash, len(env.sm.submitted))
+				}
+			},
+		},
+		{
+			name: "server side validation failure backs off",
+			spec: func(parent *CloudEndpoint) { parent.Spec.ServerSideValidation = true },
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.opErrors["ValidateConfig"] = &servicemanagement.Status{Message: "invalid config"}
+			},
+			syncs:      3,
+			wantErr:    true,
+			state:      StateBackoff,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "ServerValidationFailed"},
+		},
+		{
+			name:       "dry run does not create the service or submit",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.DryRun = true },
+			syncs:      3,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionServiceCreated: "DryRun", ConditionConfigSubmitted: "DryRun", ConditionReady: "DryRun"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if len(env.sm.services) != 0 || len(env.sm.submitted) != 0 {
+					t.Errorf("%d services created, %d configs submitted on a dry run", len(env.sm.services), len(env.sm.submitted))
+				}
+			},
+		},
+		{
+			name: "dry run does not undelete the service",
+			spec: func(parent *CloudEndpoint) { parent.Spec.DryRun = true },
+			setup: func(env *testEnv, parent *CloudEndpoint) {
+				env.sm.deleted[testEndpoint] = &servicemanagement.ManagedService{ServiceName: testEndpoint}
+			},
+			syncs: 2,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if _, ok := env.sm.services[testEndpoint]; ok {
+					t.Errorf("service %s undeleted on a dry run", testEndpoint)
+				}
+			},
+		},
+		{
+			name:       "dry run of a new endpoint skips server side validation",
+			spec:       func(parent *CloudEndpoint) { parent.Spec.DryRun = true; parent.Spec.ServerSideValidation = true },
+			syncs:      2,
+			state:      StateIdle,
+			conditions: map[CloudEndpointConditionType]string{ConditionSpecValid: "Valid", ConditionConfigSubmitted: "DryRun"},
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.ConfigValidate != "" || strings.Contains(status.getCondition(ConditionConfigSubmitted).Message, "skipped") == false {
+					t.Errorf("configValidate = %s, condition = %+v", status.ConfigValidate, status.getCondition(ConditionConfigSubmitted))
+				}
+			},
+		},
+		{
+			name:  "dry run of an existing endpoint runs server side validation",
+			spec:  func(parent *CloudEndpoint) { parent.Spec.DryRun = true; parent.Spec.ServerSideValidation = true },
+			setup: func(env *testEnv, parent *CloudEndpoint) { seedService(env) },
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if status.ValidatedConfigHash == "" || len(env.sm.submitted) != 0 {
+					t.Errorf("validatedConfigHash = %s, %d configs submitted", status.ValidatedConfigHash, len(env.sm.submitted))
+				}
+			},
+		},
+	})
+}
+
+func TestValidateOpenAPISpec(t *testing.T) {
+	jwtDefinition := `
+securityDefinitions:
+  firebase:
+    authorizationUrl: ""
+    flow: "implicit"
+    type: "oauth2"
+    x-google-issuer: "https://securetoken.google.com/test-project"
+security:
+- firebase: []
+`
+	tests := []struct {
+		name        string
+		spec        string
+		diagnostics []string
+	}{
+		{
+			name: "valid spec",
+			spec: testOpenAPISpec,
+		},
+		{
+			name: "JWT security definition with an empty authorizationUrl",
+			spec: testOpenAPISpec + jwtDefinition,
+		},
+		{
+			name:        "host of another endpoint",
+			spec:        strings.Replace(testOpenAPISpec, `host: "{{ .Endpoint }}"`, `host: "other.example.com"`, 1),
+			diagnostics: []string{"host must be"},
+		},
+		{
+			name:        "duplicate operationId",
+			spec:        testOpenAPISpec + "  /groups:\n    get:\n      operationId: ListUsers\n      responses:\n        '200':\n          description: OK\n",
+			diagnostics: []string{"operationId 'ListUsers' is not unique"},
+		},
+		{
+			name:        "undefined security requirement",
+			spec:        testOpenAPISpec + "security:\n- api_key: []\n",
+			diagnostics: []string{"security references undefined securityDefinition: 'api_key'"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			spec, err := executeTemplate(tc.spec, newTemplateData(testEndpoint, testTarget, []string{testTarget}, nil, nil))
+			if err != nil {
+				t.Fatalf("failed to render spec: %v", err)
+			}
+			err = validateOpenAPISpec(spec, testEndpoint)
+			if len(tc.diagnostics) == 0 {
+				if err != nil {
+					t.Errorf("validateOpenAPISpec() = %v, want nil", err)
+				}
+				return
+			}
+			diagnostics := strings.Join(validationDiagnostics(err), "\n")
+			for _, d := range tc.diagnostics {
+				if strings.Contains(diagnostics, d) == false {
+					t.Errorf("diagnostics = %s, want %s", diagnostics, d)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Path of the wildcard template matching every request.
+const wildcardCatchAllPath = "/**"
+
+// Methods of the wildcard template operations when spec.wildcard.methods is not set.
+var defaultWildcardMethods = []string{"get", "delete", "patch", "post", "put"}
+
+// Ingress paths made of plain segments, other paths like regular expressions are not valid Endpoints paths.
+var ingressPlainPathRegexp = regexp.MustCompile(`^(/[A-Za-z0-9._~-]+)*/?$`)
+
+// wildcardPath is a path of the wildcard template and the backend Service the Ingress routes it to.
+type wildcardPath struct {
+	path    string
+	backend string
+}
+
+// usesWildcardTemplate returns true if the config is rendered from the wildcard template.
+func usesWildcardTemplate(parent *CloudEndpoint) bool {
+	return parent.Spec.GRPC == nil && len(parent.Spec.OpenAPISpecFrom) == 0 && parent.Spec.OpenAPISpec == "" &&
+		(parent.Spec.OpenAPISpecConfigMap.Name == "" || parent.Spec.OpenAPISpecConfigMap.Key == "")
+}
+
+// wildcardAPITemplate returns the wildcard template for spec.wildcard and, with pathsFromIngress, the hash of the Ingress paths.
+func wildcardAPITemplate(parent *CloudEndpoint) (string, string, error) {
+	spec := parent.Spec.Wildcard
+	paths := []wildcardPath{{path: wildcardCatchAllPath}}
+	if spec == nil {
+		return getWildcardAPITemplate(paths, defaultWildcardMethods, false), "", nil
+	}
+
+	methods := defaultWildcardMethods
+	if len(spec.Methods) > 0 {
+		methods = make([]string, 0, len(spec.Methods))
+		for _, m := range spec.Methods {
+			m = strings.ToLower(m)
+			if containsFold(openAPIOperations, m) == false {
+				return "", "", fmt.Errorf("Invalid wildcard.methods entry: '%s', must be one of: %s", m, strings.Join(openAPIOperations, ", "))
+			}
+			if containsFold(methods, m) == false {
+				methods = append(methods, m)
+			}
+		}
+	}
+
+	hash := ""
+	if spec.PathsFromIngress {
+		var err error
+		if paths, err = ingressWildcardPaths(parent); err != nil {
+			return "", "", err
+		}
+		hash = wildcardPathsHash(paths)
+	}
+	return getWildcardAPITemplate(paths, methods, spec.AllowAll), hash, nil
+}
+
+// ingressWildcardPaths returns the paths of the target Ingress rules converted to wildcard template paths, followed by the catch-all path.
+// Prefix paths like /api or /api/* become /api/**. Paths that are not plain, like regular expressions, are skipped and served by the catch-all path.
+func ingressWildcardPaths(parent *CloudEndpoint) ([]wildcardPath, error) {
+	if parent.Spec.TargetIngress.Name == "" {
+		return nil, fmt.Errorf("wildcard.pathsFromIngress requires targetIngress")
+	}
+	spec := targetIngressSpec(parent)
+	if targetIngressKind(spec) != TargetKindIngress {
+		return nil, fmt.Errorf("wildcard.pathsFromIngress is only supported with targetIngress kind %s", TargetKindIngress)
+	}
+	ingress, _, err := resolveTargetIngress(spec)
+	if err != nil {
+		return nil, err
+	}
+	if ingress == nil {
+		return nil, sourceNotFoundError{fmt.Sprintf("Ingress '%s' not found in namespace '%s'", spec.Name, spec.Namespace)}
+	}
+
+	backends := make(map[string][]string)
+	rules, _, _ := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	for _, r := range rules {
+		rule, _ := r.(map[string]interface{})
+		httpPaths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, hp := range httpPaths {
+			httpPath, _ := hp.(map[string]interface{})
+			p, _, _ := unstructured.NestedString(httpPath, "path")
+			pathType, _, _ := unstructured.NestedString(httpPath, "pathType")
+			// networking.k8s.io/v1 and extensions/v1beta1 backends.
+			backend, _, _ := unstructured.NestedString(httpPath, "backend", "service", "name")
+			if backend == "" {
+				backend, _, _ = unstructured.NestedString(httpPath, "backend", "serviceName")
+			}
+			key, ok := wildcardPathFromIngress(p, pathType)
+			if ok == false {
+				continue
+			}
+			if _, ok := backends[key]; ok == false {
+				backends[key] = nil
+			}
+			if backend != "" && containsFold(backends[key], backend) == false {
+				backends[key] = append(backends[key], backend)
+			}
+		}
+	}
+
+	paths := make([]wildcardPath, 0, len(backends)+1)
+	for p, b := range backends {
+		if p == wildcardCatchAllPath {
+			continue
+		}
+		sort.Strings(b)
+		paths = append(paths, wildcardPath{path: p, backend: strings.Join(b, ", ")})
+	}
+	sort.Slice(paths, func(i, j int) bool { return paths[i].path < paths[j].path })
+	catchAll := wildcardPath{path: wildcardCatchAllPath}
+	if b, ok := backends[wildcardCatchAllPath]; ok {
+		sort.Strings(b)
+		catchAll.backend = strings.Join(b, ", ")
+	}
+	return append(paths, catchAll), nil
+}
+
+// wildcardPathFromIngress converts an Ingress path to a wildcard template path, exact paths are kept as is.
+// It returns false if the path is not made of plain segments.
+func wildcardPathFromIngress(p, pathType string) (string, bool) {
+	if pathType != "Exact" || p == "" {
+		p = strings.TrimSuffix(p, "*")
+	}
+	if ingressPlainPathRegexp.MatchString(p) == false {
+		return "", false
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == "." || segment == ".." {
+			return "", false
+		}
+	}
+	if pathType == "Exact" && p != "" {
+		return p, true
+	}
+	return strings.TrimSuffix(p, "/") + wildcardCatchAllPath, true
+}
+
+func wildcardPathsHash(paths []wildcardPath) string {
+	var b bytes.Buffer
+	for _, p := range paths {
+		fmt.Fprintf(&b, "%s=%s\n", p.path, p.backend)
+	}
+	return toSha1(b.String())
+}
+
+// wildcardOperationID returns the operationId of the method on the path, for example GetApiV1 for get on /api/v1/**.
+// Operations on the catch-all path are named after the method only.
+func wildcardOperationID(method, p string) string {
+	var b strings.Builder
+	b.WriteString(strings.Title(method))
+	for _, segment := range strings.FieldsFunc(p, func(r rune) bool {
+		return (r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') == false
+	}) {
+		b.WriteString(strings.Title(strings.ToLower(segment)))
+	}
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestSyncWildcard(t *testing.T) {
+	runSyncTests(t, []syncTest{
+		{
+			name: "wildcard paths from the Ingress skip paths that are not plain",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web"}
+				parent.Spec.Wildcard = &CloudEndpointWildcard{PathsFromIngress: true}
+			},
+			targets: []runtime.Object{testIngress("default", "web", []string{"203.0.113.40"},
+				testIngressPath("/api", "Prefix", "api"),
+				testIngressPath("/foo(/|$)(.*)", "ImplementationSpecific", "foo"),
+				testIngressPath("/{{ .Endpoint }}", "Prefix", "bar"),
+				testIngressPath("/healthz", "Exact", "api"),
+			)},
+			syncs: 4,
+			state: StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				spec := submittedFiles(t, env, 0)[0]
+				for _, p := range []string{`"/api/**"`, `"/healthz"`, `"/**"`} {
+					if strings.Contains(spec, p) == false {
+						t.Errorf("path %s missing from spec:\n%s", p, spec)
+					}
+				}
+				if strings.Contains(spec, "foo(") || strings.Contains(spec, "Backend: bar") {
+					t.Errorf("path that is not plain added to spec:\n%s", spec)
+				}
+			},
+		},
+		{
+			name: "wildcard backend names are not rendered as template actions",
+			spec: func(parent *CloudEndpoint) {
+				parent.Spec.Target = ""
+				parent.Spec.TargetIngress = CloudEndpointTargetIngressSpec{Name: "web"}
+				parent.Spec.Wildcard = &CloudEndpointWildcard{PathsFromIngress: true}
+			},
+			targets: []runtime.Object{testIngress("default", "web", []string{"203.0.113.40"}, testIngressPath("/api", "Prefix", "{{ .Endpoint }}"))},
+			syncs:   4,
+			state:   StateIdle,
+			check: func(t *testing.T, env *testEnv, status *CloudEndpointControllerStatus) {
+				if spec := submittedFiles(t, env, 0)[0]; strings.Contains(spec, "Backend: {{ .Endpoint }}") == false {
+					t.Errorf("backend name not escaped in spec:\n%s", spec)
+				}
+			},
+		},
+	})
+}
+
+func TestWildcardPathFromIngress(t *testing.T) {
+	for _, tc := range []struct {
+		path, pathType, want string
+		ok                   bool
+	}{
+		{"/api", "Prefix", "/api/**", true},
+		{"/api/", "Prefix", "/api/**", true},
+		{"/static/*", "ImplementationSpecific", "/static/**", true},
+		{"/healthz", "Exact", "/healthz", true},
+		{"", "Prefix", "/**", true},
+		{"/foo(/|$)(.*)", "ImplementationSpecific", "", false},
+		{"/{{ .Endpoint }}", "Prefix", "", false},
+		{"/api/../admin", "Prefix", "", false},
+	} {
+		got, ok := wildcardPathFromIngress(tc.path, tc.pathType)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("wildcardPathFromIngress(%q, %s) = %q, %v, want %q, %v", tc.path, tc.pathType, got, ok, tc.want, tc.ok)
+		}
+	}
+}
+
+func TestWildcardOperationID(t *testing.T) {
+	for p, want := range map[string]string{
+		"/api/v1/**": "GetApiV1",
+		"/**":        "Get",
+		"/user-info": "GetUserInfo",
+	} {
+		if got := wildcardOperationID("get", p); got != want {
+			t.Errorf("wildcardOperationID(get, %s) = %s, want %s", p, got, want)
+		}
+	}
+}